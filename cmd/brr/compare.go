@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/allenan/brr/internal/compare"
+	"github.com/allenan/brr/internal/history"
+	"github.com/allenan/brr/internal/speedtest"
+)
+
+// comparisonOutput is the --compare --json document.
+type comparisonOutput struct {
+	Result     *speedtest.Result `json:"result"`
+	Comparison *compare.Report   `json:"comparison"` // nil when there is no baseline
+}
+
+// metricLabels are the display names for compare.Metric names.
+var metricLabels = map[string]string{
+	"download":             "Download",
+	"upload":               "Upload",
+	"idle_latency":         "Latency",
+	"jitter":               "Jitter",
+	"download_latency":     "Latency (↓ load)",
+	"upload_latency":       "Latency (↑ load)",
+	"bufferbloat_download": "Bufferbloat ↓",
+	"bufferbloat_upload":   "Bufferbloat ↑",
+	"bidir_download":       "Download (⇅)",
+	"bidir_upload":         "Upload (⇅)",
+	"bidir_latency":        "Latency (⇅ load)",
+	"bufferbloat_bidir":    "Bufferbloat ⇅",
+}
+
+// loadBaseline returns the run to compare against and a description of it.
+// It returns a nil result if there is no history yet.
+func loadBaseline(store *history.Store) (*speedtest.Result, string, error) {
+	if flagCompareAvg > 0 {
+		avg, err := store.Average(flagCompareAvg)
+		if err != nil {
+			return nil, "", err
+		}
+		return avg, fmt.Sprintf("average of last %d runs", flagCompareAvg), nil
+	}
+
+	entries, err := store.LastOK(1)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(entries) == 0 {
+		return nil, "", nil
+	}
+	prev := entries[0]
+	return &prev, "previous run (" + prev.Timestamp.Format("2006-01-02 15:04") + ")", nil
+}
+
+// printComparison writes a per-metric comparison table.
+func printComparison(w io.Writer, report *compare.Report) {
+	if report == nil {
+		fmt.Fprintln(w, "No previous run to compare")
+		return
+	}
+
+	fmt.Fprintf(w, "Compared with %s:\n\n", report.Baseline)
+	printMetrics(w, report.Metrics, "Before", "Now")
+}
+
+// printMetrics writes a per-metric table of baseline and current values
+// under the given column headings.
+func printMetrics(w io.Writer, metrics []compare.Metric, baselineHeading, currentHeading string) {
+	fmt.Fprintf(w, "%-18s  %12s  %12s  %s\n", "Metric", baselineHeading, currentHeading, "Change")
+	fmt.Fprintf(w, "%-18s  %12s  %12s  %s\n",
+		"──────────────────", "────────────", "────────────", "──────────────────────")
+
+	for _, m := range metrics {
+		label := metricLabels[m.Name]
+		if label == "" {
+			label = m.Name
+		}
+
+		var before, now, change string
+		if m.Unit == "grade" {
+			before, now = gradeOrDash(m.BaselineGrade), gradeOrDash(m.CurrentGrade)
+			change = fmt.Sprintf("%+.0f grade", m.Delta)
+		} else {
+			before = fmt.Sprintf("%.1f %s", m.Baseline, m.Unit)
+			now = fmt.Sprintf("%.1f %s", m.Current, m.Unit)
+			change = fmt.Sprintf("%+.1f %s", m.Delta, m.Unit)
+			if m.Percent != nil {
+				change += fmt.Sprintf(" (%+.1f%%)", *m.Percent)
+			}
+		}
+
+		line := fmt.Sprintf("%-18s  %12s  %12s  %-22s  %s", label, before, now, change, changeMark(m.Change))
+		fmt.Fprintln(w, strings.TrimRight(line, " "))
+	}
+}
+
+func gradeOrDash(g speedtest.BufferbloatGrade) string {
+	if g == "" {
+		return "—"
+	}
+	return string(g)
+}
+
+func changeMark(c compare.Change) string {
+	switch c {
+	case compare.Better:
+		return "✓ better"
+	case compare.Worse:
+		return "✗ worse"
+	default:
+		return ""
+	}
+}
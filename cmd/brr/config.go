@@ -0,0 +1,286 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/allenan/brr/internal/config"
+	"github.com/allenan/brr/internal/history"
+	"github.com/allenan/brr/internal/speedtest"
+)
+
+var flagConfig string
+
+// cfg is the config file merged with the environment, loaded before any
+// command runs. Flags are applied on top by applyConfig.
+var cfg = &config.Config{}
+
+// cfgPath is the config file cfg was loaded from, and whether it existed.
+var (
+	cfgPath  string
+	cfgFound bool
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the configuration file",
+	Long: "brr reads settings from config.toml in its config directory, or the file named by --config " +
+		"or BRR_CONFIG. BRR_* environment variables override the file, and flags override both.",
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the effective configuration",
+	Long: "Print the configuration in effect after merging the config file, BRR_* environment variables and defaults, as TOML. " +
+		"The engine settings and duration are those of the selected profile.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		eff, err := effectiveConfig()
+		if err != nil {
+			cmd.SilenceUsage = true
+			return err
+		}
+		if cfgFound {
+			fmt.Printf("# Config file: %s\n", cfgPath)
+		} else {
+			fmt.Printf("# Config file: %s (not found)\n", cfgPath)
+		}
+		var env []string
+		for _, name := range config.EnvNames() {
+			if os.Getenv(name) != "" {
+				env = append(env, name)
+			}
+		}
+		if len(env) > 0 {
+			fmt.Printf("# Environment: %s\n", strings.Join(env, ", "))
+		}
+		fmt.Println()
+		return eff.Encode(os.Stdout)
+	},
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&flagConfig, "config", "", "Config file (default: config.toml in brr's config directory, or $BRR_CONFIG)")
+	rootCmd.PersistentPreRunE = applyConfig
+	configShowCmd.Flags().StringVar(&flagProfile, "profile", "", "Show the engine settings of this profile (default: the configured one)")
+	configShowCmd.Flags().DurationVar(&flagDuration, "duration", 0, "Show the settings with this phase duration")
+	configCmd.AddCommand(configShowCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+// applyConfig loads the config file and environment into cfg, then copies
+// each setting into its flag variable unless the flag was given.
+func applyConfig(cmd *cobra.Command, args []string) error {
+	if err := loadConfig(); err != nil {
+		cmd.SilenceUsage = true // the flags are fine; the file isn't
+		return err
+	}
+
+	fs := cmd.Flags()
+	unset := func(names ...string) bool {
+		for _, name := range names {
+			if f := fs.Lookup(name); f != nil && f.Changed {
+				return false
+			}
+		}
+		return true
+	}
+	if cfg.Server != "" && unset("server") {
+		flagServer = cfg.Server
+	}
+	if cfg.Echo != "" && unset("echo") {
+		flagEcho = cfg.Echo
+	}
+	if cfg.Profile != "" && unset("profile") {
+		flagProfile = cfg.Profile
+	}
+	if cfg.Theme != "" && unset("theme") {
+		flagTheme = cfg.Theme
+	}
+	if cfg.Output != "" && cfg.Output != "tui" && unset("format", "json", "simple") {
+		flagFormat = cfg.Output
+	}
+	if cfg.History.Keep != 0 && unset("history-keep") {
+		flagHistoryKeep = cfg.History.Keep
+	}
+	if cfg.History.MaxAge != 0 && unset("history-max-age") {
+		flagHistoryMaxAge = cfg.History.MaxAge
+	}
+	if cfg.History.CompactAfter != 0 && unset("history-compact-after") {
+		flagHistoryCompactAfter = cfg.History.CompactAfter
+	}
+	return nil
+}
+
+// loadConfig reads the config file named by --config, $BRR_CONFIG or the
+// default path, and applies the environment to it. Only an explicitly named
+// file has to exist.
+func loadConfig() error {
+	cfgPath = flagConfig
+	if cfgPath == "" {
+		cfgPath = os.Getenv("BRR_CONFIG")
+	}
+	explicit := cfgPath != ""
+	if !explicit {
+		cfgPath = config.DefaultPath()
+	}
+	_, err := os.Stat(cfgPath)
+	cfgFound = err == nil
+	if explicit && !cfgFound {
+		return fmt.Errorf("config file %s: %w", cfgPath, err)
+	}
+
+	loaded, err := config.Load(cfgPath)
+	if err != nil {
+		return err
+	}
+	if err := loaded.ApplyEnv(os.Getenv); err != nil {
+		return err
+	}
+	cfg = loaded
+	return nil
+}
+
+// profileConfig returns the engine configuration for the named profile:
+// a built-in profile, or one from the config file's [profiles] tables. The
+// standard profile carries the config file's duration and [engine]
+// settings; --duration is applied later, on top of any profile.
+func profileConfig(name string) (speedtest.Config, error) {
+	if name == "" {
+		name = speedtest.DefaultProfile
+	}
+	if name == speedtest.DefaultProfile {
+		c := speedtest.DefaultConfig()
+		applyEngineConfig(&c, cfg.Engine)
+		c.PhaseDuration = time.Duration(cfg.Duration)
+		return c, nil
+	}
+	if c, ok := speedtest.ProfileConfig(name); ok {
+		return c, nil
+	}
+
+	p, ok := cfg.Profiles[name]
+	if !ok {
+		names := speedtest.ProfileNames()
+		for n := range cfg.Profiles {
+			if !slices.Contains(names, n) {
+				names = append(names, n)
+			}
+		}
+		slices.Sort(names)
+		return speedtest.Config{}, fmt.Errorf("unknown profile %q: expected one of %s", name, strings.Join(names, ", "))
+	}
+	base := p.Base
+	if base == "" {
+		base = speedtest.DefaultProfile
+	}
+	if _, ok := speedtest.ProfileConfig(base); !ok {
+		return speedtest.Config{}, fmt.Errorf("profile %q: base must be a built-in profile (%s), got %q",
+			name, strings.Join(speedtest.ProfileNames(), ", "), base)
+	}
+	c, _ := profileConfig(base)
+	applyEngineConfig(&c, p.Engine)
+	if p.Duration != 0 {
+		c.PhaseDuration = time.Duration(p.Duration)
+	}
+	c.FullDuration = c.FullDuration || p.FullDuration
+	c.NoDownload = c.NoDownload || p.NoDownload
+	c.NoUpload = c.NoUpload || p.NoUpload
+	c.Bidirectional = c.Bidirectional || p.Bidirectional
+	return c, nil
+}
+
+// applyEngineConfig copies the [engine] settings that are set onto c.
+func applyEngineConfig(c *speedtest.Config, e config.Engine) {
+	if len(e.DownloadSequence) > 0 {
+		c.DownloadSequence = transferSpecs(e.DownloadSequence)
+	}
+	if len(e.UploadSequence) > 0 {
+		c.UploadSequence = transferSpecs(e.UploadSequence)
+	}
+	if e.InitialConnections > 0 {
+		c.InitialConnections = e.InitialConnections
+	}
+	if e.MaxConnections > 0 {
+		c.MaxConnections = e.MaxConnections
+	}
+	if e.LatencyProbes > 0 {
+		c.LatencyProbes = e.LatencyProbes
+	}
+	if e.LatencyInterval > 0 {
+		c.LatencyInterval = time.Duration(e.LatencyInterval)
+	}
+	if e.SetupProbes > 0 {
+		c.SetupProbes = e.SetupProbes
+	}
+}
+
+func transferSpecs(ts []config.Transfer) []speedtest.TransferSpec {
+	specs := make([]speedtest.TransferSpec, len(ts))
+	for i, t := range ts {
+		specs[i] = speedtest.TransferSpec{Bytes: t.Bytes, Count: t.Count}
+	}
+	return specs
+}
+
+// effectiveConfig returns the settings in effect, with defaults filled in.
+// The engine settings and duration are those of the selected profile.
+func effectiveConfig() (*config.Config, error) {
+	engine, err := profileConfig(flagProfile)
+	if err != nil {
+		return nil, fmt.Errorf("--profile: %w", err)
+	}
+
+	eff := &config.Config{
+		Server:   flagServer,
+		Echo:     flagEcho,
+		Duration: config.Duration(engine.PhaseDuration),
+		Theme:    flagTheme,
+		Output:   flagFormat,
+		Profile:  flagProfile,
+		Profiles: cfg.Profiles,
+		Engine: config.Engine{
+			InitialConnections: engine.InitialConnections,
+			MaxConnections:     engine.MaxConnections,
+			LatencyProbes:      engine.LatencyProbes,
+			LatencyInterval:    config.Duration(engine.LatencyInterval),
+			SetupProbes:        engine.SetupProbes,
+		},
+		History: config.History{
+			Path:         cfg.History.Path,
+			Keep:         flagHistoryKeep,
+			MaxAge:       flagHistoryMaxAge,
+			CompactAfter: flagHistoryCompactAfter,
+		},
+	}
+	if eff.Server == "" {
+		eff.Server = "cloudflare"
+	}
+	if flagDuration > 0 {
+		eff.Duration = config.Duration(flagDuration)
+	}
+	if eff.Profile == "" {
+		eff.Profile = speedtest.DefaultProfile
+	}
+	if eff.Theme == "" {
+		eff.Theme = "default"
+	}
+	if eff.Output == "" {
+		eff.Output = "tui"
+	}
+	if eff.History.Path == "" {
+		eff.History.Path = history.DefaultDir()
+	}
+	for _, s := range engine.DownloadSequence {
+		eff.Engine.DownloadSequence = append(eff.Engine.DownloadSequence, config.Transfer{Bytes: s.Bytes, Count: s.Count})
+	}
+	for _, s := range engine.UploadSequence {
+		eff.Engine.UploadSequence = append(eff.Engine.UploadSequence, config.Transfer{Bytes: s.Bytes, Count: s.Count})
+	}
+	return eff, nil
+}
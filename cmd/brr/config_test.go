@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/allenan/brr/internal/config"
+	"github.com/allenan/brr/internal/speedtest"
+)
+
+func TestEffectiveConfigProfile(t *testing.T) {
+	t.Cleanup(func() { cfg, flagProfile, flagDuration = &config.Config{}, "", 0 })
+	cfg = &config.Config{Engine: config.Engine{MaxConnections: 8}}
+
+	eff, err := effectiveConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eff.Profile != speedtest.DefaultProfile || eff.Engine.MaxConnections != 8 {
+		t.Errorf("default: profile %q, %d connections; want %q with the [engine] override",
+			eff.Profile, eff.Engine.MaxConnections, speedtest.DefaultProfile)
+	}
+
+	flagProfile = "thorough"
+	thorough, _ := speedtest.ProfileConfig("thorough")
+	eff, err = effectiveConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eff.Engine.MaxConnections != thorough.MaxConnections || eff.Engine.LatencyProbes != thorough.LatencyProbes ||
+		time.Duration(eff.Duration) != thorough.PhaseDuration {
+		t.Errorf("thorough: %+v, duration %v; want the profile's settings", eff.Engine, eff.Duration)
+	}
+
+	flagDuration = 5 * time.Second
+	if eff, err = effectiveConfig(); err != nil || time.Duration(eff.Duration) != flagDuration {
+		t.Errorf("with --duration: duration %v, %v; want 5s", eff.Duration, err)
+	}
+
+	flagProfile = "nope"
+	if _, err := effectiveConfig(); err == nil {
+		t.Error("unknown profile accepted")
+	}
+}
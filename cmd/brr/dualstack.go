@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/allenan/brr/internal/assert"
+	"github.com/allenan/brr/internal/compare"
+	"github.com/allenan/brr/internal/export"
+	"github.com/allenan/brr/internal/notify"
+	"github.com/allenan/brr/internal/speedtest"
+)
+
+// dualStackOutput is the --dual-stack --json document. A family whose test
+// failed has a result with its status and error.
+type dualStackOutput struct {
+	IPv4 *speedtest.Result `json:"ipv4"`
+	IPv6 *speedtest.Result `json:"ipv6"`
+}
+
+// runDualStack runs the test over IPv4 and then over IPv6 and reports both.
+// A family that fails, as IPv6 often does, doesn't stop the other from
+// being tested and reported; brr then exits as for the first failure.
+func runDualStack(ctx context.Context, engine *speedtest.Engine, format string, assertions []assert.Assertion, notifier *notify.Notifier) error {
+	store := openStore()
+	save := format == "simple"
+
+	var runs []familyRun
+	for _, family := range []speedtest.AddressFamily{speedtest.FamilyIPv4, speedtest.FamilyIPv6} {
+		e := *engine
+		e.UseFamily(family)
+		fmt.Fprintf(os.Stderr, "Testing over %s...\n", family)
+
+		result, err := e.Run(ctx, &cliCallback{})
+		if err != nil {
+			result = failedResult(ctx, &e, err)
+			result.Server.AddressFamily = family
+		}
+		if save {
+			store.Save(result)
+		}
+		if result.Status == speedtest.StatusCancelled {
+			return runError(result, err)
+		}
+		runs = append(runs, familyRun{result: result, err: err})
+	}
+
+	err := writeOutput(func(w io.Writer) error {
+		return printDualStack(w, format, runs[0].result, runs[1].result)
+	})
+	if err != nil {
+		return err
+	}
+	for _, run := range runs {
+		sendNotification(ctx, notifier, run.result, logStderr)
+	}
+	return dualStackError(os.Stderr, runs, assertions)
+}
+
+// familyRun is the outcome of the test over one address family.
+type familyRun struct {
+	result *speedtest.Result // a failed result if err is set
+	err    error
+}
+
+// dualStackError returns the error brr exits with after a dual-stack run:
+// that of the first family that failed, or else of the assertions that
+// failed for either family.
+func dualStackError(stderr io.Writer, runs []familyRun, assertions []assert.Assertion) error {
+	results := make([]*speedtest.Result, len(runs))
+	for i, run := range runs {
+		if run.err != nil {
+			return fmt.Errorf("%s: %w", run.result.Server.AddressFamily, runError(run.result, run.err))
+		}
+		results[i] = run.result
+	}
+	return checkAssertions(stderr, assertions, results...)
+}
+
+// printDualStack writes the IPv4 and IPv6 results in format. Simple output
+// has a line per family and, when both succeeded, a table comparing IPv6
+// with IPv4.
+func printDualStack(w io.Writer, format string, v4, v6 *speedtest.Result) error {
+	switch format {
+	case "json":
+		return writeJSON(w, dualStackOutput{IPv4: v4, IPv6: v6})
+	case "influx":
+		for _, result := range []*speedtest.Result{v4, v6} {
+			if !result.Status.OK() {
+				continue
+			}
+			if err := export.ToInflux(w, result); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, result := range []*speedtest.Result{v4, v6} {
+		if !result.Status.OK() {
+			fmt.Fprintf(w, "%s  failed: %s\n", result.Server.AddressFamily, result.Error)
+			continue
+		}
+		fmt.Fprintf(w, "%s  %s  %s → %s\n",
+			result.Server.AddressFamily,
+			speedtest.Headline(result),
+			result.Server.Location,
+			result.Server.ColoCity,
+		)
+	}
+
+	if v4.Status.OK() && v6.Status.OK() {
+		fmt.Fprintf(w, "\nIPv6 compared with IPv4:\n\n")
+		printMetrics(w, compare.Diff(v6, v4), "IPv4", "IPv6")
+	}
+	return nil
+}
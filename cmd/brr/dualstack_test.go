@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/allenan/brr/internal/assert"
+	"github.com/allenan/brr/internal/speedtest"
+)
+
+func familyResult(family speedtest.AddressFamily, mbps float64) *speedtest.Result {
+	return &speedtest.Result{
+		Status:        speedtest.StatusOK,
+		Server:        speedtest.ServerInfo{Colo: "SEA", ColoCity: "Seattle, WA", Location: "US", AddressFamily: family},
+		Download:      &speedtest.PhaseResult{Mbps: mbps},
+		Upload:        &speedtest.PhaseResult{Mbps: mbps / 10},
+		IdleLatency:   speedtest.LatencyResult{Avg: 20},
+		BufferbloatDL: speedtest.GradeA,
+		BufferbloatUL: speedtest.GradeB,
+	}
+}
+
+// failedFamily is a run over family that failed with err, as runDualStack
+// records it.
+func failedFamily(family speedtest.AddressFamily, status speedtest.RunStatus, err error) familyRun {
+	result := speedtest.FailedResult(err)
+	result.Status = status
+	result.Server.AddressFamily = family
+	return familyRun{result: result, err: err}
+}
+
+func TestPrintDualStackJSON(t *testing.T) {
+	v6 := failedFamily(speedtest.FamilyIPv6, speedtest.StatusError, errors.New("dial tcp6: no route to host"))
+
+	var b strings.Builder
+	if err := printDualStack(&b, "json", familyResult(speedtest.FamilyIPv4, 300), v6.result); err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+		Server struct {
+			AddressFamily string `json:"address_family"`
+		}
+		Download *struct{ Mbps float64 }
+	}
+	if err := json.Unmarshal([]byte(b.String()), &doc); err != nil {
+		t.Fatalf("output isn't JSON: %v\n%s", err, b.String())
+	}
+	if len(doc) != 2 {
+		t.Errorf("keys = %v, want ipv4 and ipv6", doc)
+	}
+	v4out, v6out := doc["ipv4"], doc["ipv6"]
+	if v4out.Server.AddressFamily != "ipv4" || v4out.Download == nil || v4out.Download.Mbps != 300 {
+		t.Errorf("ipv4 = %+v", v4out)
+	}
+	if v6out.Server.AddressFamily != "ipv6" || v6out.Status != "error" || !strings.Contains(v6out.Error, "no route") || v6out.Download != nil {
+		t.Errorf("ipv6 = %+v, want the failed run", v6out)
+	}
+}
+
+func TestPrintDualStackSimple(t *testing.T) {
+	v4, v6 := familyResult(speedtest.FamilyIPv4, 300), familyResult(speedtest.FamilyIPv6, 100)
+
+	var b strings.Builder
+	if err := printDualStack(&b, "simple", v4, v6); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	lines := strings.Split(out, "\n")
+	if !strings.HasPrefix(lines[0], "IPv4  ↓ 300.0 Mbps") || !strings.HasPrefix(lines[1], "IPv6  ↓ 100.0 Mbps") {
+		t.Errorf("family lines:\n%s", out)
+	}
+	if !strings.Contains(out, "IPv6 compared with IPv4:") || !strings.Contains(out, "-66.7%") {
+		t.Errorf("no IPv6-vs-IPv4 table:\n%s", out)
+	}
+
+	// A failed family is still reported, without a comparison
+	failed := failedFamily(speedtest.FamilyIPv6, speedtest.StatusPreflightFailed, errors.New("no IPv6 route"))
+	b.Reset()
+	if err := printDualStack(&b, "simple", v4, failed.result); err != nil {
+		t.Fatal(err)
+	}
+	out = b.String()
+	if !strings.HasPrefix(out, "IPv4  ↓ 300.0 Mbps") || !strings.Contains(out, "IPv6  failed: no IPv6 route\n") {
+		t.Errorf("output with a failed family:\n%s", out)
+	}
+	if strings.Contains(out, "compared with") {
+		t.Errorf("comparison printed against a failed run:\n%s", out)
+	}
+
+	b.Reset()
+	if err := printDualStack(&b, "influx", v4, failed.result); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(b.String(), "\n"); n != 1 || !strings.Contains(b.String(), "family=ipv4") {
+		t.Errorf("influx output has %d points, want only the IPv4 one:\n%s", n, b.String())
+	}
+}
+
+func TestDualStackError(t *testing.T) {
+	ok4 := familyRun{result: familyResult(speedtest.FamilyIPv4, 300)}
+	ok6 := familyRun{result: familyResult(speedtest.FamilyIPv6, 50)}
+	assertions, err := assert.Parse("download>=100")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		runs       []familyRun
+		wantCode   int // 0 for no error
+		wantPrefix string
+		wantStderr []string
+	}{
+		{"both pass", []familyRun{ok4, {result: familyResult(speedtest.FamilyIPv6, 200)}}, 0, "", nil},
+		{"IPv6 below threshold", []familyRun{ok4, ok6}, exitAssertion, "1 of 2 assertions failed",
+			[]string{"✗ IPv6: download>=100: got 50.0 Mbps\n"}},
+		{"IPv6 preflight failed", []familyRun{ok4, failedFamily(speedtest.FamilyIPv6, speedtest.StatusPreflightFailed, errors.New("no route"))},
+			exitPreflight, "IPv6: ", nil},
+		{"both failed: first wins", []familyRun{
+			failedFamily(speedtest.FamilyIPv4, speedtest.StatusError, errors.New("reset")),
+			failedFamily(speedtest.FamilyIPv6, speedtest.StatusPreflightFailed, errors.New("no route")),
+		}, exitTestFailed, "IPv4: reset", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stderr strings.Builder
+			err := dualStackError(&stderr, tt.runs, assertions)
+			if tt.wantCode == 0 {
+				if err != nil {
+					t.Fatalf("error = %v, want nil", err)
+				}
+				return
+			}
+			var ee *exitError
+			if !errors.As(err, &ee) || ee.code != tt.wantCode {
+				t.Fatalf("error = %v, want exit code %d", err, tt.wantCode)
+			}
+			if !strings.HasPrefix(err.Error(), tt.wantPrefix) {
+				t.Errorf("error = %q, want prefix %q", err, tt.wantPrefix)
+			}
+			if got := stderr.String(); got != strings.Join(tt.wantStderr, "") {
+				t.Errorf("stderr = %q, want %q", got, tt.wantStderr)
+			}
+		})
+	}
+}
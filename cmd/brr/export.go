@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/allenan/brr/internal/export"
+)
+
+var (
+	exportFilter     queryFlags
+	flagExportFormat string
+	flagExportLayout string
+	flagExportOut    string
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export history as CSV, JSON or JSON Lines",
+	Long: "Write the runs selected by the filters, oldest first, to --out or stdout. " +
+		"The CSV summary layout has one row per run; --layout samples has one row per raw " +
+		"throughput or latency sample, tagged with its run and phase, for plotting.\n\n" +
+		"Without --format, the format follows the extension of --out (.csv, .json, .jsonl or " +
+		".ndjson), or is CSV on stdout.",
+	Example: `  brr export --since 30d --out runs.csv
+  brr export --layout samples --since 2024-03-01 --out samples.csv
+  brr export --format jsonl --colo SEA > sea.jsonl`,
+	Args: cobra.NoArgs,
+	RunE: runExport,
+}
+
+func init() {
+	exportFilter.register(exportCmd.Flags(), 0, "Export at most this many of the most recent runs (0 = all)")
+	exportCmd.Flags().StringVar(&flagExportFormat, "format", "", "Output format: csv, json or jsonl")
+	exportCmd.Flags().StringVar(&flagExportLayout, "layout", "summary", "CSV layout: summary (one row per run) or samples (one row per sample)")
+	exportCmd.Flags().StringVarP(&flagExportOut, "out", "o", "", "Write to this file instead of stdout")
+	rootCmd.AddCommand(exportCmd)
+}
+
+func runExport(cmd *cobra.Command, args []string) error {
+	format := flagExportFormat
+	if format == "" {
+		var err error
+		if format, err = formatFromPath(flagExportOut); err != nil {
+			return err
+		}
+	}
+	switch format {
+	case "csv", "json", "jsonl":
+	default:
+		return fmt.Errorf("unknown --format %q: expected csv, json or jsonl", format)
+	}
+	switch flagExportLayout {
+	case "summary":
+	case "samples":
+		if format != "csv" {
+			return fmt.Errorf("--layout samples requires --format csv")
+		}
+	default:
+		return fmt.Errorf("unknown --layout %q: expected summary or samples", flagExportLayout)
+	}
+
+	q, err := exportFilter.query(time.Now())
+	if err != nil {
+		return err
+	}
+	entries, err := openStore().Query(q)
+	if err != nil {
+		return err
+	}
+	slices.Reverse(entries) // oldest first reads and plots naturally
+
+	write := func(w io.Writer) error {
+		switch {
+		case format == "json":
+			return export.ToJSONArray(w, entries)
+		case format == "jsonl":
+			return export.ToJSONL(w, entries)
+		case flagExportLayout == "samples":
+			return export.ToSamplesCSV(w, entries)
+		default:
+			return export.ToCSV(w, entries)
+		}
+	}
+
+	if flagExportOut == "" || flagExportOut == "-" {
+		return write(os.Stdout)
+	}
+	f, err := os.Create(flagExportOut)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d runs to %s\n", len(entries), flagExportOut)
+	return nil
+}
+
+// formatFromPath picks an export format from the extension of path, the
+// --out file. Stdout gets CSV; an extension it doesn't know is an error
+// rather than a CSV file under a misleading name.
+func formatFromPath(path string) (string, error) {
+	if path == "" || path == "-" {
+		return "csv", nil
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return "csv", nil
+	case ".json":
+		return "json", nil
+	case ".jsonl", ".ndjson":
+		return "jsonl", nil
+	default:
+		return "", fmt.Errorf("can't tell the format of %s from its extension: use --format csv, json or jsonl", path)
+	}
+}
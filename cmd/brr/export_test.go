@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestFormatFromPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string // empty for an error
+	}{
+		{"", "csv"},
+		{"-", "csv"},
+		{"runs.csv", "csv"},
+		{"runs.CSV", "csv"},
+		{"runs.json", "json"},
+		{"runs.jsonl", "jsonl"},
+		{"out/runs.ndjson", "jsonl"},
+		{"runs.txt", ""},
+		{"runs.json.gz", ""},
+		{"runs", ""},
+	}
+
+	for _, tt := range tests {
+		got, err := formatFromPath(tt.path)
+		switch {
+		case tt.want == "" && err == nil:
+			t.Errorf("formatFromPath(%q) = %q, want an error", tt.path, got)
+		case tt.want != "" && (err != nil || got != tt.want):
+			t.Errorf("formatFromPath(%q) = %q, %v; want %q", tt.path, got, err, tt.want)
+		}
+	}
+}
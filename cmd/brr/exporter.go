@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/allenan/brr/internal/exporter"
+)
+
+var (
+	flagExporterListen      string
+	flagExporterInterval    time.Duration
+	flagExporterMinInterval time.Duration
+)
+
+var exporterCmd = &cobra.Command{
+	Use:   "exporter",
+	Short: "Serve speed test results as Prometheus metrics",
+	Long: "Serve the latest speed test result on /metrics in Prometheus text format. " +
+		"By default a scrape runs a test when the cached result is older than --min-interval; " +
+		"with --interval, tests run on a schedule and scrapes read the cache.",
+	Args: cobra.NoArgs,
+	RunE: runExporter,
+}
+
+func init() {
+	exporterCmd.Flags().StringVar(&flagExporterListen, "listen", ":9798", "Address to serve metrics on")
+	exporterCmd.Flags().DurationVar(&flagExporterInterval, "interval", 0, "Run a test on this schedule (e.g. 15m) instead of on scrape")
+	exporterCmd.Flags().DurationVar(&flagExporterMinInterval, "min-interval", exporter.DefaultMinInterval, "Minimum time between tests started by scrapes")
+	addEngineFlags(exporterCmd.Flags())
+	rootCmd.AddCommand(exporterCmd)
+}
+
+func runExporter(cmd *cobra.Command, args []string) error {
+	if flagExporterInterval < 0 || flagExporterMinInterval < 0 {
+		return fmt.Errorf("--interval and --min-interval must be positive")
+	}
+
+	engine, err := newEngine()
+	if err != nil {
+		return err
+	}
+
+	exp := exporter.New(engine)
+	exp.Interval = flagExporterInterval
+	exp.MinInterval = flagExporterMinInterval
+
+	srv := &http.Server{
+		Addr:              flagExporterListen,
+		Handler:           exp.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ln, err := net.Listen("tcp", flagExporterListen)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Serving metrics on http://%s/metrics\n", ln.Addr())
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	go exp.Run(ctx)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Serve(ln)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/allenan/brr/internal/config"
+	"github.com/allenan/brr/internal/export"
+	"github.com/allenan/brr/internal/history"
+	"github.com/allenan/brr/internal/speedtest"
+)
+
+var (
+	flagHistoryKeep         int
+	flagHistoryMaxAge       config.Duration
+	flagHistoryCompactAfter config.Duration
+
+	historyFilter      queryFlags
+	flagHistoryStats   bool
+	flagHistoryGroupBy string
+	flagHistoryFormat  string
+)
+
+// defaultHistoryLimit is how many runs a plain history listing shows.
+const defaultHistoryLimit = 20
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show history of past runs",
+	Long: "List past runs, optionally filtered by time, colo and grade. With --stats, print " +
+		"min/median/P90/max of each metric instead, optionally grouped by day, hour of day or colo.",
+	Example: `  brr history --since 7d --colo SEA
+  brr history --stats --group-by hour --since 30d
+  brr history --grade C,D,F --format csv`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// --limit defaults to a screenful for listings but to everything for --stats
+		if flagHistoryStats && !cmd.Flags().Changed("limit") {
+			historyFilter.limit = 0
+		}
+		return showHistory()
+	},
+}
+
+var historyPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Apply history retention now and report the space reclaimed",
+	Long: "Remove entries beyond --history-keep or older than --history-max-age, and drop the raw " +
+		"samples from entries older than --history-compact-after, keeping their summary statistics.",
+	Args: cobra.NoArgs,
+	RunE: runHistoryPrune,
+}
+
+func init() {
+	rootCmd.PersistentFlags().IntVar(&flagHistoryKeep, "history-keep", 0, "Keep at most this many history entries (0 = unlimited)")
+	rootCmd.PersistentFlags().Var(&flagHistoryMaxAge, "history-max-age", "Remove history entries older than this (e.g. 90d, 720h)")
+	rootCmd.PersistentFlags().Var(&flagHistoryCompactAfter, "history-compact-after", "Drop raw samples from history entries older than this when pruning (e.g. 30d)")
+	historyFilter.register(historyCmd.Flags(), defaultHistoryLimit,
+		"Show at most this many of the most recent runs (with --stats: all unless set)")
+	historyCmd.Flags().BoolVar(&flagHistoryStats, "stats", false, "Print min/median/P90/max per metric instead of individual runs")
+	historyCmd.Flags().StringVar(&flagHistoryGroupBy, "group-by", "", "Group --stats by day, hour (of day) or colo")
+	historyCmd.Flags().StringVar(&flagHistoryFormat, "format", "table", "Output format: table, json or csv")
+	historyCmd.AddCommand(historyPruneCmd)
+	rootCmd.AddCommand(historyCmd)
+}
+
+// openStore returns the history store with the retention flags applied.
+func openStore() *history.Store {
+	dir := cfg.History.Path
+	if dir == "" {
+		dir = history.DefaultDir()
+	}
+	store := history.NewStoreAt(dir)
+	store.Retention = retention()
+	return store
+}
+
+func retention() history.Retention {
+	return history.Retention{
+		MaxEntries:   flagHistoryKeep,
+		MaxAge:       time.Duration(flagHistoryMaxAge),
+		CompactAfter: time.Duration(flagHistoryCompactAfter),
+	}
+}
+
+func runHistoryPrune(cmd *cobra.Command, args []string) error {
+	r := retention()
+	if r == (history.Retention{}) {
+		return fmt.Errorf("no retention set: use --history-keep, --history-max-age or --history-compact-after")
+	}
+
+	stats, err := openStore().Prune(r)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Removed %d, compacted %d, kept %d entries\n", stats.Removed, stats.Compacted, stats.Kept)
+	fmt.Printf("Reclaimed %s (%s → %s)\n",
+		formatBytes(stats.Reclaimed()), formatBytes(stats.BytesBefore), formatBytes(stats.BytesAfter))
+	return nil
+}
+
+// showHistory prints the runs selected by the history flags, or their
+// statistics with --stats.
+func showHistory() error {
+	q, err := historyFilter.query(time.Now())
+	if err != nil {
+		return err
+	}
+	groupBy, err := history.ParseGroupBy(flagHistoryGroupBy)
+	if err != nil {
+		return fmt.Errorf("--group-by: %w", err)
+	}
+	if groupBy != history.GroupNone && !flagHistoryStats {
+		return fmt.Errorf("--group-by requires --stats")
+	}
+	switch flagHistoryFormat {
+	case "table", "json", "csv":
+	default:
+		return fmt.Errorf("unknown --format %q: expected table, json or csv", flagHistoryFormat)
+	}
+
+	entries, err := openStore().Query(q)
+	if err != nil {
+		return err
+	}
+
+	if flagHistoryStats {
+		stats := history.Summarize(entries, groupBy)
+		switch flagHistoryFormat {
+		case "json":
+			return writeJSON(os.Stdout, stats)
+		case "csv":
+			return writeStatsCSV(os.Stdout, stats)
+		}
+		printStats(os.Stdout, stats)
+		return nil
+	}
+
+	switch flagHistoryFormat {
+	case "json":
+		if entries == nil {
+			entries = []speedtest.Result{}
+		}
+		return writeJSON(os.Stdout, entries)
+	case "csv":
+		return export.ToCSV(os.Stdout, entries)
+	}
+	printHistory(os.Stdout, entries)
+	return nil
+}
+
+// queryFlags are the history filter flags shared by brr history and
+// brr export.
+type queryFlags struct {
+	since  string
+	until  string
+	colos  []string
+	grades []string
+	limit  int
+}
+
+func (f *queryFlags) register(fs *pflag.FlagSet, defaultLimit int, limitUsage string) {
+	fs.StringVar(&f.since, "since", "", "Only runs at or after this time: a date (2006-01-02), RFC 3339 time, or age (7d, 12h)")
+	fs.StringVar(&f.until, "until", "", "Only runs before this time, in the same forms as --since")
+	fs.StringSliceVar(&f.colos, "colo", nil, "Only runs against these colos (comma-separated)")
+	fs.StringSliceVar(&f.grades, "grade", nil, "Only runs with these download bufferbloat grades, e.g. C,D,F")
+	fs.IntVar(&f.limit, "limit", defaultLimit, limitUsage)
+}
+
+// query builds a history query from the filter flags.
+func (f *queryFlags) query(now time.Time) (history.Query, error) {
+	q := history.Query{
+		Colos: f.colos,
+		Limit: f.limit,
+	}
+	var err error
+	if q.Since, err = parseTimeFlag(f.since, now); err != nil {
+		return q, fmt.Errorf("--since: %w", err)
+	}
+	if q.Until, err = parseTimeFlag(f.until, now); err != nil {
+		return q, fmt.Errorf("--until: %w", err)
+	}
+	for _, g := range f.grades {
+		grade := speedtest.BufferbloatGrade(strings.ToUpper(strings.TrimSpace(g)))
+		if grade.Score() < 0 {
+			return q, fmt.Errorf("--grade: unknown grade %q", g)
+		}
+		q.Grades = append(q.Grades, grade)
+	}
+	return q, nil
+}
+
+// parseTimeFlag parses a point in time given as a date, an RFC 3339
+// timestamp, or an age before now such as 7d or 12h. Dates are local.
+func parseTimeFlag(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01-02T15:04", "2006-01-02 15:04"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if age, err := config.ParseDuration(s); err == nil {
+		return now.Add(-age), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q: want a date (2006-01-02), RFC 3339 time, or age (7d, 12h)", s)
+}
+
+// printHistory writes runs as a table.
+func printHistory(w io.Writer, entries []speedtest.Result) {
+	if len(entries) == 0 {
+		fmt.Fprintln(w, "No matching runs.")
+		return
+	}
+
+	fmt.Fprintf(w, "%-20s  %-12s  %10s  %10s  %8s  %5s  %s\n",
+		"Date", "Server", "Download", "Upload", "Latency", "Grade", "Status")
+	fmt.Fprintf(w, "%-20s  %-12s  %10s  %10s  %8s  %5s  %s\n",
+		"────────────────────", "────────────", "──────────", "──────────", "────────", "─────", "────────────────")
+
+	failed := 0
+	for _, e := range entries {
+		date := e.Timestamp.Format("2006-01-02 15:04")
+		if !e.Status.OK() {
+			failed++
+			fmt.Fprintf(w, "%-20s  %-12s  %13s  %13s  %8s  %5s  %s\n",
+				date, "—", "—", "—", "—", "—", e.Status)
+			continue
+		}
+		server := e.Server.Colo
+		if len(server) == 0 {
+			server = "—"
+		}
+		fmt.Fprintf(w, "%-20s  %-12s  %s  %s  %6.0fms  %5s  %s\n",
+			date, server,
+			mbpsCell(e.Download), mbpsCell(e.Upload),
+			e.IdleLatency.Avg, e.BufferbloatDL, speedtest.StatusOK)
+	}
+	if failed > 0 {
+		fmt.Fprintf(w, "\n%d of %d runs did not complete\n", failed, len(entries))
+	}
+}
+
+// mbpsCell formats a speed for the history table, with a dash for a phase
+// the run skipped.
+func mbpsCell(p *speedtest.PhaseResult) string {
+	if p == nil {
+		return fmt.Sprintf("%13s", "—")
+	}
+	return fmt.Sprintf("%8.1f Mbps", p.Mbps)
+}
+
+// printStats writes per-group metric distributions as a table.
+func printStats(w io.Writer, stats []history.GroupStats) {
+	if len(stats) == 0 {
+		fmt.Fprintln(w, "No matching runs.")
+		return
+	}
+
+	fmt.Fprintf(w, "%-12s  %5s  %6s  %-18s  %12s  %12s  %12s  %12s\n",
+		"Group", "Runs", "Failed", "Metric", "Min", "Median", "P90", "Max")
+	fmt.Fprintf(w, "%-12s  %5s  %6s  %-18s  %12s  %12s  %12s  %12s\n",
+		"────────────", "─────", "──────", "──────────────────", "────────────", "────────────", "────────────", "────────────")
+
+	for _, g := range stats {
+		group, runs, failed := g.Group, strconv.Itoa(g.Runs), strconv.Itoa(g.Failed)
+		if len(g.Metrics) == 0 {
+			fmt.Fprintf(w, "%-12s  %5s  %6s  %-18s\n", group, runs, failed, "—")
+			continue
+		}
+		for _, m := range g.Metrics {
+			label := metricLabels[m.Metric]
+			if label == "" {
+				label = m.Metric
+			}
+			fmt.Fprintf(w, "%-12s  %5s  %6s  %-18s  %12s  %12s  %12s  %12s\n",
+				group, runs, failed, label,
+				formatStat(m.Min, m.Unit), formatStat(m.Median, m.Unit),
+				formatStat(m.P90, m.Unit), formatStat(m.Max, m.Unit))
+			group, runs, failed = "", "", ""
+		}
+	}
+}
+
+func formatStat(v float64, unit string) string {
+	return fmt.Sprintf("%.1f %s", v, unit)
+}
+
+// writeStatsCSV writes one row per group and metric.
+func writeStatsCSV(w io.Writer, stats []history.GroupStats) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"group", "runs", "failed", "metric", "unit", "min", "median", "p90", "max"})
+	for _, g := range stats {
+		for _, m := range g.Metrics {
+			cw.Write([]string{
+				g.Group, strconv.Itoa(g.Runs), strconv.Itoa(g.Failed), m.Metric, m.Unit,
+				fmt.Sprintf("%.2f", m.Min), fmt.Sprintf("%.2f", m.Median),
+				fmt.Sprintf("%.2f", m.P90), fmt.Sprintf("%.2f", m.Max),
+			})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// formatBytes renders n in B, KB or MB.
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
@@ -2,15 +2,24 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"os"
 	"os/signal"
+	"strings"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
-	"github.com/allenan/brr/internal/history"
+	"github.com/allenan/brr/internal/assert"
+	"github.com/allenan/brr/internal/compare"
+	"github.com/allenan/brr/internal/export"
+	"github.com/allenan/brr/internal/notify"
+	"github.com/allenan/brr/internal/preflight"
 	"github.com/allenan/brr/internal/speedtest"
 	"github.com/allenan/brr/internal/tui"
 )
@@ -20,11 +29,25 @@ var version = "dev"
 var (
 	flagJSON       bool
 	flagSimple     bool
+	flagFormat     string
+	flagOut        string
 	flagHistory    bool
 	flagCompare    bool
+	flagCompareAvg int
 	flagFullscreen bool
 	flagTheme      string
 	flagServer     string
+	flagDuration   time.Duration
+	flagProfile    string
+	flagDLOnly     bool
+	flagULOnly     bool
+	flagNoUpload   bool
+	flagBidir      bool
+	flagIPv4       bool
+	flagIPv6       bool
+	flagDualStack  bool
+	flagEcho       string
+	flagAssert     string
 )
 
 var rootCmd = &cobra.Command{
@@ -38,11 +61,32 @@ var rootCmd = &cobra.Command{
 func init() {
 	rootCmd.Flags().BoolVar(&flagJSON, "json", false, "Output results as JSON")
 	rootCmd.Flags().BoolVar(&flagSimple, "simple", false, "Output a single summary line")
+	rootCmd.Flags().StringVar(&flagFormat, "format", "", "Output format: json, simple, influx (line protocol) or textfile (node_exporter .prom file, needs --out)")
+	rootCmd.Flags().StringVarP(&flagOut, "out", "o", "", "Write the output to this file instead of stdout")
 	rootCmd.Flags().BoolVar(&flagHistory, "history", false, "Show history of past runs")
 	rootCmd.Flags().BoolVar(&flagCompare, "compare", false, "Compare current run with previous")
+	rootCmd.Flags().IntVar(&flagCompareAvg, "compare-avg", 0, "Compare against the average of the last N runs (implies --compare)")
 	rootCmd.Flags().BoolVar(&flagFullscreen, "fullscreen", false, "Run in fullscreen (alt-screen) mode")
 	rootCmd.Flags().StringVar(&flagTheme, "theme", "default", "Color theme: default, colorblind, mono")
-	rootCmd.Flags().StringVar(&flagServer, "server", "", "Override test server")
+	rootCmd.Flags().BoolVar(&flagDualStack, "dual-stack", false, "Run the test over IPv4 and then over IPv6, and report them side by side")
+	rootCmd.Flags().StringVar(&flagAssert, "assert", "", "Fail with exit code 4 unless the result meets these thresholds, e.g. 'download>=100,latency<=40,bloat>=B'")
+	addEngineFlags(rootCmd.Flags())
+	addNotifyFlags(rootCmd.Flags())
+}
+
+// addEngineFlags registers the flags read by newEngine, for every command
+// that runs speed tests.
+func addEngineFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&flagProfile, "profile", "", "Test profile: "+strings.Join(speedtest.ProfileNames(), ", ")+", or one defined in the config file (default "+speedtest.DefaultProfile+")")
+	fs.DurationVar(&flagDuration, "duration", 0, "Run download and upload for up to this long each (e.g. 10s) instead of fixed transfer sizes")
+	fs.BoolVar(&flagDLOnly, "download-only", false, "Measure latency and download only")
+	fs.BoolVar(&flagULOnly, "upload-only", false, "Measure latency and upload only")
+	fs.BoolVar(&flagNoUpload, "no-upload", false, "Skip the upload phase (e.g. on metered links)")
+	fs.BoolVar(&flagBidir, "bidir", false, "Add a phase that downloads and uploads at the same time, as a video call does, and grade its bufferbloat")
+	fs.BoolVarP(&flagIPv4, "ipv4", "4", false, "Connect over IPv4 only")
+	fs.BoolVarP(&flagIPv6, "ipv6", "6", false, "Connect over IPv6 only")
+	fs.StringVar(&flagEcho, "echo", "", "UDP echo server (host:port) for packet loss probes, e.g. a brr serve host")
+	fs.StringVar(&flagServer, "server", "", "Test server: a base URL or a named backend (cloudflare)")
 }
 
 func run(cmd *cobra.Command, args []string) error {
@@ -50,14 +94,125 @@ func run(cmd *cobra.Command, args []string) error {
 		return showHistory()
 	}
 
+	engine, err := newEngine()
+	if err != nil {
+		return err
+	}
+
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
 
-	if flagJSON || flagSimple {
-		return runHeadless(ctx)
+	if flagCompareAvg > 0 {
+		flagCompare = true
+	}
+
+	format, err := outputFormat()
+	if err != nil {
+		return err
+	}
+	var assertions []assert.Assertion
+	if flagAssert != "" {
+		if assertions, err = assert.Parse(flagAssert); err != nil {
+			return fmt.Errorf("--assert: %w", err)
+		}
+	}
+	notifier, err := newNotifier()
+	if err != nil {
+		return err
+	}
+	if flagDualStack {
+		switch {
+		case flagIPv4 || flagIPv6:
+			return fmt.Errorf("--dual-stack conflicts with -4 and -6")
+		case flagCompare:
+			return fmt.Errorf("--dual-stack conflicts with --compare")
+		case format == "textfile":
+			return fmt.Errorf("--dual-stack is not supported with --format textfile")
+		}
+	}
+	// The flags are valid; errors from here on aren't usage errors
+	cmd.SilenceUsage = true
+
+	if flagDualStack {
+		if format == "" {
+			format = "simple"
+		}
+		return runDualStack(ctx, engine, format, assertions, notifier)
+	}
+	if format != "" || flagCompare || assertions != nil || notifier != nil {
+		if format == "" {
+			format = "simple"
+		}
+		return runHeadless(ctx, engine, format, assertions, notifier)
 	}
 
-	return runTUI(ctx)
+	return runTUI(ctx, engine)
+}
+
+// newEngine builds a speed test engine from the command-line flags.
+func newEngine() (*speedtest.Engine, error) {
+	backend, err := speedtest.ParseBackend(flagServer)
+	if err != nil {
+		return nil, fmt.Errorf("--server: %w", err)
+	}
+	if flagDuration < 0 {
+		return nil, fmt.Errorf("--duration must be positive")
+	}
+
+	engine := speedtest.NewEngine(backend)
+	engine.Config, err = profileConfig(flagProfile)
+	if err != nil {
+		return nil, fmt.Errorf("--profile: %w", err)
+	}
+	if flagDuration > 0 {
+		engine.Config.PhaseDuration = flagDuration
+	}
+	switch {
+	case flagULOnly && (flagDLOnly || flagNoUpload):
+		return nil, fmt.Errorf("--upload-only conflicts with --download-only and --no-upload")
+	case flagDLOnly:
+		engine.Config.NoDownload, engine.Config.NoUpload = false, true
+	case flagULOnly:
+		engine.Config.NoDownload, engine.Config.NoUpload = true, false
+	}
+	if flagNoUpload {
+		engine.Config.NoUpload = true
+	}
+	if flagBidir {
+		engine.Config.Bidirectional = true
+	}
+	switch {
+	case flagIPv4 && flagIPv6:
+		return nil, fmt.Errorf("-4 and -6 conflict; use --dual-stack to test both")
+	case flagIPv4:
+		engine.UseFamily(speedtest.FamilyIPv4)
+	case flagIPv6:
+		engine.UseFamily(speedtest.FamilyIPv6)
+	}
+
+	if flagEcho != "" {
+		if _, _, err := net.SplitHostPort(flagEcho); err != nil {
+			return nil, fmt.Errorf("--echo: %w", err)
+		}
+		engine.EchoAddr = flagEcho
+	}
+	return engine, nil
+}
+
+// failedResult builds the history entry for a run that returned err. Unless
+// the run was cancelled, preflight checks run first so that a network outage
+// is recorded as such, with the checks that failed.
+func failedResult(ctx context.Context, engine *speedtest.Engine, err error) *speedtest.Result {
+	if ctx.Err() != nil {
+		return speedtest.FailedResult(err)
+	}
+	client := speedtest.NewHTTPClient(engine.Family)
+	client.Timeout = 10 * time.Second
+	pre := preflight.Run(ctx, client, engine.Backend, engine.Family, func(preflight.CheckResult) {})
+	if !pre.Passed {
+		return pre.FailedResult()
+	}
+	return speedtest.FailedResult(err)
 }
 
 type cliCallback struct{}
@@ -72,49 +227,187 @@ func (c *cliCallback) OnPhase(phase speedtest.Phase) {
 		fmt.Fprintf(os.Stderr, "Testing download...\n")
 	case speedtest.PhaseUpload:
 		fmt.Fprintf(os.Stderr, "Testing upload...\n")
+	case speedtest.PhaseBidirectional:
+		fmt.Fprintf(os.Stderr, "Testing download and upload together...\n")
 	case speedtest.PhaseDone:
 		fmt.Fprintf(os.Stderr, "Done.\n")
 	}
 }
-func (c *cliCallback) OnDownloadSample(s speedtest.Sample)              {}
-func (c *cliCallback) OnUploadSample(s speedtest.Sample)                {}
-func (c *cliCallback) OnIdleLatencySample(s speedtest.LatencySample)    {}
-func (c *cliCallback) OnLoadedLatencySample(s speedtest.LatencySample)  {}
+func (c *cliCallback) OnDownloadSample(s speedtest.Sample)             {}
+func (c *cliCallback) OnUploadSample(s speedtest.Sample)               {}
+func (c *cliCallback) OnIdleLatencySample(s speedtest.LatencySample)   {}
+func (c *cliCallback) OnLoadedLatencySample(s speedtest.LatencySample) {}
+
+// outputFormat resolves --format and its --json and --simple shorthands.
+// It returns "" for the TUI.
+func outputFormat() (string, error) {
+	format := flagFormat
+	for _, short := range []struct {
+		set  bool
+		name string
+	}{
+		{flagJSON, "json"},
+		{flagSimple, "simple"},
+	} {
+		if !short.set {
+			continue
+		}
+		if format != "" && format != short.name {
+			return "", fmt.Errorf("--%s conflicts with --format %s", short.name, format)
+		}
+		format = short.name
+	}
+
+	switch format {
+	case "", "json", "simple":
+	case "influx", "textfile":
+		if flagCompare {
+			return "", fmt.Errorf("--compare is not supported with --format %s", format)
+		}
+	default:
+		return "", fmt.Errorf("unknown --format %q: expected json, simple, influx or textfile", format)
+	}
+	if format == "textfile" && flagOut == "" {
+		return "", fmt.Errorf("--format textfile needs --out, e.g. /var/lib/node_exporter/textfile/brr.prom")
+	}
+	if flagOut != "" && format == "" {
+		return "", fmt.Errorf("--out needs --format")
+	}
+	return format, nil
+}
+
+func runHeadless(ctx context.Context, engine *speedtest.Engine, format string, assertions []assert.Assertion, notifier *notify.Notifier) error {
+	store := openStore()
+	// Machine-readable output isn't saved, to not pollute programmatic usage
+	save := format == "simple"
+
+	// Load the comparison baseline before this run is saved
+	var baseline *speedtest.Result
+	var baselineDesc string
+	if flagCompare {
+		var err error
+		baseline, baselineDesc, err = loadBaseline(store)
+		if err != nil {
+			return fmt.Errorf("loading history: %w", err)
+		}
+	}
 
-func runHeadless(ctx context.Context) error {
-	engine := speedtest.NewEngine()
 	result, err := engine.Run(ctx, &cliCallback{})
 	if err != nil {
-		return err
+		failed := failedResult(ctx, engine, err)
+		if save {
+			store.Save(failed)
+		}
+		sendNotification(ctx, notifier, failed, logStderr)
+		return runError(failed, err)
 	}
 
-	// Save to history (unless --json, to not pollute programmatic usage)
-	if !flagJSON {
-		store := history.NewStore()
+	if save {
 		store.Save(result)
 	}
 
-	if flagJSON {
-		enc := json.NewEncoder(os.Stdout)
-		enc.SetIndent("", "  ")
-		return enc.Encode(result)
+	var report *compare.Report
+	if baseline != nil {
+		report = &compare.Report{
+			Baseline: baselineDesc,
+			Metrics:  compare.Diff(result, baseline),
+		}
+	}
+
+	if err := writeResult(format, result, report); err != nil {
+		return err
+	}
+	sendNotification(ctx, notifier, result, logStderr)
+	return checkAssertions(os.Stderr, assertions, result)
+}
+
+// logStderr prints a message line to stderr.
+func logStderr(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+}
+
+// writeResult writes result in format to --out or stdout.
+func writeResult(format string, result *speedtest.Result, report *compare.Report) error {
+	if format == "textfile" {
+		return export.WriteTextfile(flagOut, result)
+	}
+	return writeOutput(func(w io.Writer) error {
+		return printResult(w, format, result, report)
+	})
+}
+
+// writeOutput calls print with --out, or stdout.
+func writeOutput(print func(io.Writer) error) error {
+	if flagOut == "" {
+		return print(os.Stdout)
+	}
+	f, err := os.Create(flagOut)
+	if err != nil {
+		return err
+	}
+	if err := print(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// checkAssertions evaluates assertions against each of results, listing the
+// failed ones on stderr so they don't mix with machine-readable output.
+// With several results, each failure is labeled with its address family.
+func checkAssertions(stderr io.Writer, assertions []assert.Assertion, results ...*speedtest.Result) error {
+	if len(assertions) == 0 {
+		return nil
+	}
+	var failed int
+	for _, result := range results {
+		var label string
+		if len(results) > 1 {
+			label = result.Server.AddressFamily.String() + ": "
+		}
+		for _, o := range assert.Failed(assert.Evaluate(assertions, result)) {
+			fmt.Fprintf(stderr, "✗ %s%s: got %s\n", label, o.Assertion.Expr, o.Actual)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return &exitError{
+			code: exitAssertion,
+			err:  fmt.Errorf("%d of %d assertions failed", failed, len(assertions)*len(results)),
+		}
+	}
+	return nil
+}
+
+// printResult writes result, and report with --compare, in format.
+func printResult(w io.Writer, format string, result *speedtest.Result, report *compare.Report) error {
+	switch format {
+	case "json":
+		if flagCompare {
+			return writeJSON(w, comparisonOutput{Result: result, Comparison: report})
+		}
+		return export.ToJSON(w, result)
+	case "influx":
+		return export.ToInflux(w, result)
 	}
 
 	// Simple one-line output
-	fmt.Printf("↓ %.1f Mbps  ↑ %.1f Mbps  ⏱ %.1fms  Bloat: %s  %s → %s\n",
-		result.Download.Mbps,
-		result.Upload.Mbps,
-		result.IdleLatency.Avg,
-		result.BufferbloatDL,
+	fmt.Fprintf(w, "%s  %s → %s\n",
+		speedtest.Headline(result),
 		result.Server.Location,
 		result.Server.ColoCity,
 	)
+
+	if flagCompare {
+		fmt.Fprintln(w)
+		printComparison(w, report)
+	}
 	return nil
 }
 
-func runTUI(ctx context.Context) error {
-	store := history.NewStore()
-	m := tui.NewModel(flagTheme, store)
+func runTUI(ctx context.Context, engine *speedtest.Engine) error {
+	store := openStore()
+	m := tui.NewModel(flagTheme, store, engine)
 
 	opts := []tea.ProgramOption{
 		tea.WithMouseCellMotion(),
@@ -130,38 +423,42 @@ func runTUI(ctx context.Context) error {
 	return err
 }
 
-func showHistory() error {
-	store := history.NewStore()
-	entries, err := store.Last(20)
-	if err != nil {
-		return err
-	}
-	if len(entries) == 0 {
-		fmt.Println("No history yet. Run brr to create your first entry.")
-		return nil
-	}
+// Exit codes, so scripts can tell a slow link from a broken one.
+const (
+	exitGeneral     = 1 // usage and other errors
+	exitTestFailed  = 2 // the speed test failed
+	exitPreflight   = 3 // preflight checks failed: no usable network path
+	exitAssertion   = 4 // the test ran but --assert thresholds weren't met
+	exitInterrupted = 130
+)
 
-	fmt.Printf("%-20s  %-12s  %10s  %10s  %8s  %5s\n",
-		"Date", "Server", "Download", "Upload", "Latency", "Grade")
-	fmt.Printf("%-20s  %-12s  %10s  %10s  %8s  %5s\n",
-		"────────────────────", "────────────", "──────────", "──────────", "────────", "─────")
+// exitError is an error that exits brr with a specific code.
+type exitError struct {
+	code int
+	err  error
+}
 
-	for _, e := range entries {
-		date := e.Timestamp.Format("2006-01-02 15:04")
-		server := e.Server.Colo
-		if len(server) == 0 {
-			server = "—"
-		}
-		fmt.Printf("%-20s  %-12s  %8.1f Mbps  %8.1f Mbps  %6.0fms  %5s\n",
-			date, server,
-			e.Download.Mbps, e.Upload.Mbps,
-			e.IdleLatency.Avg, e.BufferbloatDL)
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+// runError wraps err from a failed run in the exit code for failed's status.
+func runError(failed *speedtest.Result, err error) error {
+	switch failed.Status {
+	case speedtest.StatusPreflightFailed:
+		return &exitError{code: exitPreflight, err: fmt.Errorf("%s: %w", failed.Error, err)}
+	case speedtest.StatusCancelled:
+		return &exitError{code: exitInterrupted, err: err}
+	default:
+		return &exitError{code: exitTestFailed, err: err}
 	}
-	return nil
 }
 
 func main() {
 	if err := rootCmd.Execute(); err != nil {
-		os.Exit(1)
+		var ee *exitError
+		if errors.As(err, &ee) {
+			os.Exit(ee.code)
+		}
+		os.Exit(exitGeneral)
 	}
 }
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/allenan/brr/internal/preflight"
+	"github.com/allenan/brr/internal/speedtest"
+)
+
+func TestRunError(t *testing.T) {
+	preflightFailed := (&preflight.Result{Message: "no route to the test server"}).FailedResult()
+	tests := []struct {
+		name     string
+		failed   *speedtest.Result
+		err      error
+		wantCode int
+		wantMsg  string
+	}{
+		{"test failed", speedtest.FailedResult(errors.New("download: reset")), errors.New("download: reset"),
+			exitTestFailed, "download: reset"},
+		{"interrupted", speedtest.FailedResult(context.Canceled), context.Canceled,
+			exitInterrupted, "context canceled"},
+		{"preflight failed", preflightFailed, errors.New("metadata: no such host"),
+			exitPreflight, "no route to the test server: metadata: no such host"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := runError(tt.failed, tt.err)
+			var ee *exitError
+			if !errors.As(err, &ee) || ee.code != tt.wantCode {
+				t.Fatalf("runError() = %v, want exit code %d", err, tt.wantCode)
+			}
+			if err.Error() != tt.wantMsg {
+				t.Errorf("message = %q, want %q", err, tt.wantMsg)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("runError() = %v doesn't wrap %v", err, tt.err)
+			}
+		})
+	}
+}
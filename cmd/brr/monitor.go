@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/allenan/brr/internal/monitor"
+	"github.com/allenan/brr/internal/speedtest"
+)
+
+var (
+	flagMonitorEvery      time.Duration
+	flagMonitorCron       string
+	flagMonitorJitter     time.Duration
+	flagMonitorNow        bool
+	flagMonitorMaxBackoff time.Duration
+)
+
+var monitorCmd = &cobra.Command{
+	Use:   "monitor",
+	Short: "Run speed tests on a schedule and record them to history",
+	Long: "Run speed tests on a fixed interval (--every) or a cron schedule (--cron) and save each " +
+		"result to history, including failed runs. A run that is still going when the next is due causes that slot to be " +
+		"skipped; failed runs back off exponentially. Stops cleanly on SIGINT or SIGTERM.",
+	Args: cobra.NoArgs,
+	RunE: runMonitor,
+}
+
+func init() {
+	monitorCmd.Flags().DurationVar(&flagMonitorEvery, "every", 0, "Run a test at this interval (e.g. 15m)")
+	monitorCmd.Flags().StringVar(&flagMonitorCron, "cron", "", `Run on a cron schedule, e.g. "*/15 * * * *" or @hourly`)
+	monitorCmd.Flags().DurationVar(&flagMonitorJitter, "jitter", 0, "Delay each run by a random amount up to this long")
+	monitorCmd.Flags().BoolVar(&flagMonitorNow, "now", false, "Run a test immediately instead of waiting for the first slot")
+	monitorCmd.Flags().DurationVar(&flagMonitorMaxBackoff, "max-backoff", monitor.DefaultMaxBackoff, "Longest wait after repeated failures")
+	addEngineFlags(monitorCmd.Flags())
+	addNotifyFlags(monitorCmd.Flags())
+	rootCmd.AddCommand(monitorCmd)
+}
+
+func runMonitor(cmd *cobra.Command, args []string) error {
+	schedule, err := monitorSchedule()
+	if err != nil {
+		return err
+	}
+	if flagMonitorJitter < 0 {
+		return fmt.Errorf("--jitter must be positive")
+	}
+
+	engine, err := newEngine()
+	if err != nil {
+		return err
+	}
+	notifier, err := newNotifier()
+	if err != nil {
+		return err
+	}
+
+	store := openStore()
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+
+	mon := monitor.New(schedule, func(ctx context.Context) error {
+		result, err := engine.Run(ctx, nopCallback{})
+		if err != nil {
+			failed := failedResult(ctx, engine, err)
+			if err := store.Save(failed); err != nil {
+				logger.Printf("saving history: %v", err)
+			}
+			sendNotification(ctx, notifier, failed, logger.Printf)
+			return err
+		}
+		if err := store.Save(result); err != nil {
+			logger.Printf("saving history: %v", err)
+		}
+		logger.Printf("%s  %s", speedtest.Headline(result), result.Server.Colo)
+		sendNotification(ctx, notifier, result, logger.Printf)
+		return nil
+	})
+	mon.Jitter = flagMonitorJitter
+	mon.Immediate = flagMonitorNow
+	mon.MaxBackoff = flagMonitorMaxBackoff
+	mon.Logf = logger.Printf
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	err = mon.Start(ctx)
+	logger.Printf("stopped")
+	return err
+}
+
+// monitorSchedule builds the schedule from --every or --cron.
+func monitorSchedule() (monitor.Schedule, error) {
+	switch {
+	case flagMonitorEvery < 0:
+		return nil, fmt.Errorf("--every must be positive")
+	case flagMonitorEvery > 0 && flagMonitorCron != "":
+		return nil, fmt.Errorf("--every and --cron are mutually exclusive")
+	case flagMonitorEvery > 0:
+		return monitor.Every(flagMonitorEvery), nil
+	case flagMonitorCron != "":
+		return monitor.ParseCron(flagMonitorCron)
+	default:
+		return nil, fmt.Errorf("one of --every or --cron is required")
+	}
+}
+
+type nopCallback struct{}
+
+func (nopCallback) OnPhase(speedtest.Phase)                       {}
+func (nopCallback) OnDownloadSample(speedtest.Sample)             {}
+func (nopCallback) OnUploadSample(speedtest.Sample)               {}
+func (nopCallback) OnIdleLatencySample(speedtest.LatencySample)   {}
+func (nopCallback) OnLoadedLatencySample(speedtest.LatencySample) {}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/pflag"
+
+	"github.com/allenan/brr/internal/assert"
+	"github.com/allenan/brr/internal/notify"
+	"github.com/allenan/brr/internal/speedtest"
+)
+
+var (
+	flagNotifyWebhook  string
+	flagNotifyTemplate string
+	flagOnComplete     string
+	flagNotifyIf       string
+)
+
+// addNotifyFlags registers the flags read by newNotifier.
+func addNotifyFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&flagNotifyWebhook, "notify-webhook", "", "POST the result as JSON to this URL after each run")
+	fs.StringVar(&flagNotifyTemplate, "notify-template", "", "Go template file for the webhook payload, e.g. for Slack or Discord")
+	fs.StringVar(&flagOnComplete, "on-complete", "", "Run this shell command after each run, with the result JSON on stdin and BRR_* variables set")
+	fs.StringVar(&flagNotifyIf, "notify-if", "", "Only notify when one of these conditions holds, e.g. 'download<100,bloat<B' (failed runs always notify)")
+}
+
+// newNotifier builds a notifier from the notify flags. It returns nil if no
+// hook is configured.
+func newNotifier() (*notify.Notifier, error) {
+	if flagNotifyWebhook == "" && flagOnComplete == "" {
+		if flagNotifyTemplate != "" || flagNotifyIf != "" {
+			return nil, fmt.Errorf("--notify-template and --notify-if need --notify-webhook or --on-complete")
+		}
+		return nil, nil
+	}
+
+	n := &notify.Notifier{
+		WebhookURL: flagNotifyWebhook,
+		Command:    flagOnComplete,
+	}
+	if flagNotifyTemplate != "" {
+		if flagNotifyWebhook == "" {
+			return nil, fmt.Errorf("--notify-template needs --notify-webhook")
+		}
+		text, err := os.ReadFile(flagNotifyTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("--notify-template: %w", err)
+		}
+		if n.Template, err = notify.ParseTemplate(flagNotifyTemplate, string(text)); err != nil {
+			return nil, fmt.Errorf("--notify-template: %w", err)
+		}
+	}
+	if flagNotifyIf != "" {
+		var err error
+		if n.Conditions, err = assert.Parse(flagNotifyIf); err != nil {
+			return nil, fmt.Errorf("--notify-if: %w", err)
+		}
+	}
+	return n, nil
+}
+
+// sendNotification fires n for result, if configured, logging failures
+// with logf rather than failing the run.
+func sendNotification(ctx context.Context, n *notify.Notifier, result *speedtest.Result, logf func(string, ...any)) {
+	if n == nil {
+		return
+	}
+	// Let a notification in flight finish if brr is interrupted; the
+	// notifier's timeout still bounds it
+	if err := n.Notify(context.WithoutCancel(ctx), result); err != nil {
+		logf("notify: %v", err)
+	}
+}
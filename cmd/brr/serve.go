@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/allenan/brr/internal/server"
+)
+
+var (
+	flagServeListen   string
+	flagServeCert     string
+	flagServeKey      string
+	flagServeColo     string
+	flagServeLocation string
+	flagServeMaxBytes int64
+	flagServeEcho     bool
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run a self-hosted speed test server",
+	Long: "Run an HTTP(S) server speaking the same protocol as Cloudflare's speed test, " +
+		"so other hosts can test against it with brr --server.",
+	Args: cobra.NoArgs,
+	RunE: runServe,
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&flagServeListen, "listen", ":8080", "Address to listen on")
+	serveCmd.Flags().StringVar(&flagServeCert, "tls-cert", "", "TLS certificate file (enables HTTPS)")
+	serveCmd.Flags().StringVar(&flagServeKey, "tls-key", "", "TLS private key file")
+	serveCmd.Flags().StringVar(&flagServeColo, "colo", "", "Server name reported to clients (default: hostname)")
+	serveCmd.Flags().StringVar(&flagServeLocation, "location", "", "Location code reported to clients")
+	serveCmd.Flags().Int64Var(&flagServeMaxBytes, "max-bytes", server.DefaultMaxBytes, "Largest accepted download size in bytes")
+	serveCmd.Flags().BoolVar(&flagServeEcho, "udp-echo", false, "Also answer brr's UDP packet loss probes on the same port")
+	rootCmd.AddCommand(serveCmd)
+}
+
+func runServe(cmd *cobra.Command, args []string) error {
+	if (flagServeCert == "") != (flagServeKey == "") {
+		return fmt.Errorf("--tls-cert and --tls-key must be set together")
+	}
+
+	colo := flagServeColo
+	if colo == "" {
+		colo, _ = os.Hostname()
+	}
+
+	srv := &http.Server{
+		Addr: flagServeListen,
+		Handler: server.Handler(server.Options{
+			Colo:     colo,
+			Location: flagServeLocation,
+			MaxBytes: flagServeMaxBytes,
+		}),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ln, err := net.Listen("tcp", flagServeListen)
+	if err != nil {
+		return err
+	}
+
+	scheme := "http"
+	if flagServeCert != "" {
+		scheme = "https"
+	}
+	fmt.Fprintf(os.Stderr, "Serving speed tests on %s://%s\n", scheme, ln.Addr())
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	errCh := make(chan error, 2)
+	if flagServeEcho {
+		pc, err := net.ListenPacket("udp", flagServeListen)
+		if err != nil {
+			return fmt.Errorf("udp echo: %w", err)
+		}
+		defer pc.Close()
+		fmt.Fprintf(os.Stderr, "Answering UDP echo on %s\n", pc.LocalAddr())
+		go func() {
+			if err := server.ServeEcho(pc); err != nil {
+				errCh <- fmt.Errorf("udp echo: %w", err)
+			}
+		}()
+	}
+
+	go func() {
+		if flagServeCert != "" {
+			errCh <- srv.ServeTLS(ln, flagServeCert, flagServeKey)
+		} else {
+			errCh <- srv.Serve(ln)
+		}
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
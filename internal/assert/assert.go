@@ -0,0 +1,240 @@
+// Package assert checks speed test results against thresholds such as
+// "download>=100" or "bloat>=B", for gating scripts and CI on link quality.
+package assert
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/allenan/brr/internal/speedtest"
+)
+
+// Op is a comparison operator.
+type Op string
+
+const (
+	OpGE Op = ">="
+	OpLE Op = "<="
+	OpGT Op = ">"
+	OpLT Op = "<"
+	OpEQ Op = "=="
+	OpNE Op = "!="
+)
+
+// ops lists the operators longest first, so ">=" isn't read as ">". A
+// single "=" is accepted for "==".
+var ops = []Op{OpGE, OpLE, OpNE, OpEQ, OpGT, OpLT, "="}
+
+// metric reads one value from a result. Grades are read as their score,
+// A+ = 5 … F = 0, so "bloat>=B" means B or better. ok is false when the
+// result doesn't have the value, e.g. rpm from a run that didn't measure it.
+type metric struct {
+	unit  string
+	grade bool
+	value func(*speedtest.Result) (v float64, ok bool)
+}
+
+var metrics = map[string]metric{
+	"download": {unit: "Mbps", value: func(r *speedtest.Result) (float64, bool) { return phaseMbps(r.Download) }},
+	"upload":   {unit: "Mbps", value: func(r *speedtest.Result) (float64, bool) { return phaseMbps(r.Upload) }},
+	"latency": {unit: "ms", value: func(r *speedtest.Result) (float64, bool) {
+		return r.IdleLatency.Avg, len(r.IdleLatency.Samples) > 0
+	}},
+	"jitter": {unit: "ms", value: func(r *speedtest.Result) (float64, bool) {
+		return r.IdleLatency.Jitter, len(r.IdleLatency.Samples) > 0
+	}},
+	"download_latency": {unit: "ms", value: func(r *speedtest.Result) (float64, bool) {
+		return loadedLatency(r.DownloadLatency)
+	}},
+	"upload_latency": {unit: "ms", value: func(r *speedtest.Result) (float64, bool) {
+		return loadedLatency(r.UploadLatency)
+	}},
+	"bidir_download": {unit: "Mbps", value: func(r *speedtest.Result) (float64, bool) { return phaseMbps(r.BidirDownload) }},
+	"bidir_upload":   {unit: "Mbps", value: func(r *speedtest.Result) (float64, bool) { return phaseMbps(r.BidirUpload) }},
+	"bidir_latency": {unit: "ms", value: func(r *speedtest.Result) (float64, bool) {
+		return loadedLatency(r.BidirLatency)
+	}},
+	"bloat":        {grade: true, value: func(r *speedtest.Result) (float64, bool) { return gradeScore(r.BufferbloatDL) }},
+	"bloat_upload": {grade: true, value: func(r *speedtest.Result) (float64, bool) { return gradeScore(r.BufferbloatUL) }},
+	"bloat_bidir":  {grade: true, value: func(r *speedtest.Result) (float64, bool) { return gradeScore(r.BufferbloatBidir) }},
+	"rpm": {unit: "RPM", value: func(r *speedtest.Result) (float64, bool) {
+		if r.Responsiveness == nil {
+			return 0, false
+		}
+		return r.Responsiveness.RPM, true
+	}},
+	"loss": {unit: "%", value: maxLoss},
+}
+
+// aliases are alternative metric names, matching the names compare uses.
+var aliases = map[string]string{
+	"idle_latency":         "latency",
+	"bloat_download":       "bloat",
+	"bufferbloat":          "bloat",
+	"bufferbloat_download": "bloat",
+	"bufferbloat_upload":   "bloat_upload",
+	"bufferbloat_bidir":    "bloat_bidir",
+	"packet_loss":          "loss",
+}
+
+func gradeScore(g speedtest.BufferbloatGrade) (float64, bool) {
+	s := g.Score()
+	return float64(s), s >= 0
+}
+
+func phaseMbps(p *speedtest.PhaseResult) (float64, bool) {
+	if p == nil {
+		return 0, false
+	}
+	return p.Mbps, true
+}
+
+func loadedLatency(l *speedtest.LatencyResult) (float64, bool) {
+	if l == nil || len(l.Samples) == 0 {
+		return 0, false
+	}
+	return l.Avg, true
+}
+
+// maxLoss is the worst packet loss of any phase, if loss was measured.
+func maxLoss(r *speedtest.Result) (float64, bool) {
+	var worst float64
+	var ok bool
+	for _, l := range []*speedtest.LatencyResult{&r.IdleLatency, r.DownloadLatency, r.UploadLatency, r.BidirLatency} {
+		if l != nil && l.Loss != nil {
+			ok = true
+			worst = max(worst, l.Loss.LossPct)
+		}
+	}
+	return worst, ok
+}
+
+// Assertion is one parsed threshold, such as download>=100.
+type Assertion struct {
+	Metric string
+	Op     Op
+	Value  float64 // grades as their score
+	Expr   string  // as written
+}
+
+// Parse parses a comma-separated list of assertions of the form
+// <metric><op><value>, e.g. "download>=100,latency<=40,bloat>=B".
+//
+// Metrics are download and upload (Mbps); latency, jitter,
+// download_latency and upload_latency (ms); bloat and bloat_upload
+// (grades A+ through F); rpm; and loss (the worst phase's packet loss in
+// percent). Operators are >=, <=, >, <, == (or =) and !=.
+func Parse(spec string) ([]Assertion, error) {
+	var out []Assertion
+	for _, expr := range strings.Split(spec, ",") {
+		expr = strings.TrimSpace(expr)
+		if expr == "" {
+			continue
+		}
+		a, err := parseOne(expr)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no assertions in %q", spec)
+	}
+	return out, nil
+}
+
+func parseOne(expr string) (Assertion, error) {
+	for _, op := range ops {
+		name, value, found := strings.Cut(expr, string(op))
+		if !found {
+			continue
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.TrimSpace(value)
+		if alias, ok := aliases[name]; ok {
+			name = alias
+		}
+		m, ok := metrics[name]
+		if !ok {
+			return Assertion{}, fmt.Errorf("%q: unknown metric %q", expr, name)
+		}
+
+		if op == "=" {
+			op = OpEQ
+		}
+		a := Assertion{Metric: name, Op: op, Expr: expr}
+		if m.grade {
+			score := speedtest.BufferbloatGrade(strings.ToUpper(value)).Score()
+			if score < 0 {
+				return Assertion{}, fmt.Errorf("%q: %q is not a grade (A+ through F)", expr, value)
+			}
+			a.Value = float64(score)
+		} else {
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return Assertion{}, fmt.Errorf("%q: %q is not a number", expr, value)
+			}
+			a.Value = v
+		}
+		return a, nil
+	}
+	return Assertion{}, fmt.Errorf("%q: want <metric><op><value>, e.g. download>=100", expr)
+}
+
+// Outcome is the result of checking one assertion.
+type Outcome struct {
+	Assertion Assertion
+	Passed    bool
+	Actual    string // the measured value with its unit, or "not measured"
+}
+
+// Evaluate checks every assertion against result. An assertion on a value
+// the result doesn't have fails.
+func Evaluate(assertions []Assertion, result *speedtest.Result) []Outcome {
+	out := make([]Outcome, len(assertions))
+	for i, a := range assertions {
+		m := metrics[a.Metric]
+		v, ok := m.value(result)
+		o := Outcome{Assertion: a, Actual: "not measured"}
+		if ok {
+			o.Passed = compare(v, a.Op, a.Value)
+			if m.grade {
+				o.Actual = string(speedtest.GradeFromScore(v))
+			} else {
+				o.Actual = strconv.FormatFloat(v, 'f', 1, 64) + " " + m.unit
+			}
+		}
+		out[i] = o
+	}
+	return out
+}
+
+// Failed returns the outcomes that didn't pass.
+func Failed(outcomes []Outcome) []Outcome {
+	var failed []Outcome
+	for _, o := range outcomes {
+		if !o.Passed {
+			failed = append(failed, o)
+		}
+	}
+	return failed
+}
+
+func compare(v float64, op Op, threshold float64) bool {
+	switch op {
+	case OpGE:
+		return v >= threshold
+	case OpLE:
+		return v <= threshold
+	case OpGT:
+		return v > threshold
+	case OpLT:
+		return v < threshold
+	case OpEQ:
+		return v == threshold
+	case OpNE:
+		return v != threshold
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package assert
+
+import (
+	"testing"
+
+	"github.com/allenan/brr/internal/speedtest"
+)
+
+func TestEvaluate(t *testing.T) {
+	result := &speedtest.Result{
+		Download:      &speedtest.PhaseResult{Mbps: 120},
+		Upload:        &speedtest.PhaseResult{Mbps: 15},
+		IdleLatency:   speedtest.LatencyResult{Avg: 30, Samples: []speedtest.LatencySample{{RTT: 30}}},
+		BufferbloatDL: speedtest.GradeC,
+	}
+
+	tests := []struct {
+		spec   string
+		passed bool
+		actual string
+	}{
+		{"download>=100", true, "120.0 Mbps"},
+		{"upload>=20", false, "15.0 Mbps"},
+		{"upload_latency<100", false, "not measured"},
+		{"bufferbloat_bidir>=B", false, "not measured"},
+		{"latency<=40", true, "30.0 ms"},
+		{"latency<30", false, "30.0 ms"},
+		{"bloat>=B", false, "C"},
+		{"bloat>=d", true, "C"},
+		{"bufferbloat=C", true, "C"},
+		{"rpm>=500", false, "not measured"},
+	}
+	for _, tt := range tests {
+		as, err := Parse(tt.spec)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.spec, err)
+		}
+		o := Evaluate(as, result)[0]
+		if o.Passed != tt.passed || o.Actual != tt.actual {
+			t.Errorf("%s: passed=%v actual=%q, want %v %q", tt.spec, o.Passed, o.Actual, tt.passed, tt.actual)
+		}
+	}
+
+	as, err := Parse("download>=100, upload>=20 ,bloat>=B")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failed := Failed(Evaluate(as, result)); len(failed) != 2 {
+		t.Errorf("got %d failures, want 2", len(failed))
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, spec := range []string{"", "speed>=1", "download>=fast", "bloat>=G", "download"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", spec)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Package compare diffs a speed test result against a baseline run.
+package compare
+
+import (
+	"math"
+
+	"github.com/allenan/brr/internal/speedtest"
+)
+
+// Change classifies a metric delta from the user's point of view.
+type Change string
+
+const (
+	Better Change = "better"
+	Worse  Change = "worse"
+	Same   Change = "same"
+)
+
+// threshold is the relative change below which a metric counts as the same.
+const threshold = 0.05
+
+// Metric is the difference in one measurement between a baseline and the
+// current run. Grades are compared by their score (A+ = 5 … F = 0) and carry
+// their letters in BaselineGrade and CurrentGrade.
+type Metric struct {
+	Name          string                     `json:"metric"`
+	Unit          string                     `json:"unit"`
+	Baseline      float64                    `json:"baseline"`
+	Current       float64                    `json:"current"`
+	Delta         float64                    `json:"delta"`
+	Percent       *float64                   `json:"delta_pct,omitempty"` // nil for grades or a zero baseline
+	Change        Change                     `json:"change"`
+	BaselineGrade speedtest.BufferbloatGrade `json:"baseline_grade,omitempty"`
+	CurrentGrade  speedtest.BufferbloatGrade `json:"current_grade,omitempty"`
+}
+
+// Report is a full comparison of a run against a baseline.
+type Report struct {
+	Baseline string   `json:"baseline"` // human-readable description of the baseline
+	Metrics  []Metric `json:"metrics"`
+}
+
+// Diff compares current against baseline metric by metric. Metrics from a
+// phase that either run skipped are left out.
+func Diff(current, baseline *speedtest.Result) []Metric {
+	var metrics []Metric
+	if baseline.Download != nil && current.Download != nil {
+		metrics = append(metrics, numeric("download", "Mbps", baseline.Download.Mbps, current.Download.Mbps, true))
+	}
+	if baseline.Upload != nil && current.Upload != nil {
+		metrics = append(metrics, numeric("upload", "Mbps", baseline.Upload.Mbps, current.Upload.Mbps, true))
+	}
+	metrics = append(metrics,
+		numeric("idle_latency", "ms", baseline.IdleLatency.Avg, current.IdleLatency.Avg, false),
+		numeric("jitter", "ms", baseline.IdleLatency.Jitter, current.IdleLatency.Jitter, false),
+	)
+	if baseline.DownloadLatency != nil && current.DownloadLatency != nil {
+		metrics = append(metrics, numeric("download_latency", "ms", baseline.DownloadLatency.Avg, current.DownloadLatency.Avg, false))
+	}
+	if baseline.UploadLatency != nil && current.UploadLatency != nil {
+		metrics = append(metrics, numeric("upload_latency", "ms", baseline.UploadLatency.Avg, current.UploadLatency.Avg, false))
+	}
+	if baseline.BufferbloatDL != "" && current.BufferbloatDL != "" {
+		metrics = append(metrics, grade("bufferbloat_download", baseline.BufferbloatDL, current.BufferbloatDL))
+	}
+	if baseline.BufferbloatUL != "" && current.BufferbloatUL != "" {
+		metrics = append(metrics, grade("bufferbloat_upload", baseline.BufferbloatUL, current.BufferbloatUL))
+	}
+	if baseline.BidirDownload != nil && current.BidirDownload != nil {
+		metrics = append(metrics,
+			numeric("bidir_download", "Mbps", baseline.BidirDownload.Mbps, current.BidirDownload.Mbps, true),
+			numeric("bidir_upload", "Mbps", baseline.BidirUpload.Mbps, current.BidirUpload.Mbps, true),
+			numeric("bidir_latency", "ms", baseline.BidirLatency.Avg, current.BidirLatency.Avg, false),
+			grade("bufferbloat_bidir", baseline.BufferbloatBidir, current.BufferbloatBidir),
+		)
+	}
+	return metrics
+}
+
+func numeric(name, unit string, baseline, current float64, higherIsBetter bool) Metric {
+	m := Metric{
+		Name:     name,
+		Unit:     unit,
+		Baseline: baseline,
+		Current:  current,
+		Delta:    current - baseline,
+		Change:   Same,
+	}
+	if baseline == 0 {
+		return m
+	}
+
+	pct := m.Delta / baseline * 100
+	m.Percent = &pct
+	if math.Abs(pct) >= threshold*100 {
+		if (m.Delta > 0) == higherIsBetter {
+			m.Change = Better
+		} else {
+			m.Change = Worse
+		}
+	}
+	return m
+}
+
+func grade(name string, baseline, current speedtest.BufferbloatGrade) Metric {
+	m := Metric{
+		Name:          name,
+		Unit:          "grade",
+		Baseline:      float64(baseline.Score()),
+		Current:       float64(current.Score()),
+		Change:        Same,
+		BaselineGrade: baseline,
+		CurrentGrade:  current,
+	}
+	if baseline.Score() < 0 || current.Score() < 0 {
+		return m
+	}
+
+	m.Delta = m.Current - m.Baseline
+	switch {
+	case m.Delta > 0:
+		m.Change = Better
+	case m.Delta < 0:
+		m.Change = Worse
+	}
+	return m
+}
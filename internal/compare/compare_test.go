@@ -0,0 +1,135 @@
+package compare
+
+import (
+	"math"
+	"testing"
+
+	"github.com/allenan/brr/internal/speedtest"
+)
+
+func TestNumeric(t *testing.T) {
+	tests := []struct {
+		name           string
+		baseline       float64
+		current        float64
+		higherIsBetter bool
+		wantDelta      float64
+		wantPct        float64 // ignored when wantNoPct
+		wantNoPct      bool
+		want           Change
+	}{
+		{"faster", 100, 150, true, 50, 50, false, Better},
+		{"slower", 100, 80, true, -20, -20, false, Worse},
+		{"latency up", 20, 30, false, 10, 50, false, Worse},
+		{"latency down", 20, 10, false, -10, -50, false, Better},
+		{"within threshold", 100, 104, true, 4, 4, false, Same},
+		{"at threshold", 100, 95, true, -5, -5, false, Worse},
+		{"zero baseline", 0, 10, true, 10, 0, true, Same},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := numeric("x", "Mbps", tt.baseline, tt.current, tt.higherIsBetter)
+			if m.Delta != tt.wantDelta || m.Change != tt.want {
+				t.Errorf("delta %v change %q, want %v %q", m.Delta, m.Change, tt.wantDelta, tt.want)
+			}
+			switch {
+			case tt.wantNoPct && m.Percent != nil:
+				t.Errorf("percent = %v, want nil", *m.Percent)
+			case !tt.wantNoPct && (m.Percent == nil || math.Abs(*m.Percent-tt.wantPct) > 1e-9):
+				t.Errorf("percent = %v, want %v", m.Percent, tt.wantPct)
+			}
+		})
+	}
+}
+
+func TestGrade(t *testing.T) {
+	tests := []struct {
+		name              string
+		baseline, current speedtest.BufferbloatGrade
+		wantDelta         float64
+		want              Change
+	}{
+		{"better", speedtest.GradeC, speedtest.GradeA, 2, Better},
+		{"worse", speedtest.GradeAPlus, speedtest.GradeF, -5, Worse},
+		{"same", speedtest.GradeB, speedtest.GradeB, 0, Same},
+		{"no baseline grade", "", speedtest.GradeB, 0, Same},
+		{"no current grade", speedtest.GradeB, "", 0, Same},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := grade("bufferbloat_download", tt.baseline, tt.current)
+			if m.Delta != tt.wantDelta || m.Change != tt.want {
+				t.Errorf("delta %v change %q, want %v %q", m.Delta, m.Change, tt.wantDelta, tt.want)
+			}
+			if m.Unit != "grade" || m.Percent != nil || m.BaselineGrade != tt.baseline || m.CurrentGrade != tt.current {
+				t.Errorf("metric = %+v", m)
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	full := func(dl, ul float64) *speedtest.Result {
+		return &speedtest.Result{
+			Download:        &speedtest.PhaseResult{Mbps: dl},
+			Upload:          &speedtest.PhaseResult{Mbps: ul},
+			IdleLatency:     speedtest.LatencyResult{Avg: 20, Jitter: 2},
+			DownloadLatency: &speedtest.LatencyResult{Avg: 40},
+			UploadLatency:   &speedtest.LatencyResult{Avg: 60},
+			BufferbloatDL:   speedtest.GradeA,
+			BufferbloatUL:   speedtest.GradeC,
+		}
+	}
+	downloadOnly := full(100, 0)
+	downloadOnly.Upload, downloadOnly.UploadLatency, downloadOnly.BufferbloatUL = nil, nil, ""
+	bidir := full(100, 10)
+	bidir.BidirDownload = &speedtest.PhaseResult{Mbps: 80}
+	bidir.BidirUpload = &speedtest.PhaseResult{Mbps: 8}
+	bidir.BidirLatency = &speedtest.LatencyResult{Avg: 90}
+	bidir.BufferbloatBidir = speedtest.GradeD
+
+	all := []string{"download", "upload", "idle_latency", "jitter", "download_latency", "upload_latency",
+		"bufferbloat_download", "bufferbloat_upload"}
+	tests := []struct {
+		name              string
+		current, baseline *speedtest.Result
+		want              []string
+	}{
+		{"both full", full(200, 20), full(100, 10), all},
+		{"upload skipped now", downloadOnly, full(100, 10),
+			[]string{"download", "idle_latency", "jitter", "download_latency", "bufferbloat_download"}},
+		{"upload skipped before", full(100, 10), downloadOnly,
+			[]string{"download", "idle_latency", "jitter", "download_latency", "bufferbloat_download"}},
+		{"bidir both", bidir, bidir,
+			append(all[:len(all):len(all)], "bidir_download", "bidir_upload", "bidir_latency", "bufferbloat_bidir")},
+		{"bidir only now", bidir, full(100, 10), all},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics := Diff(tt.current, tt.baseline)
+			var got []string
+			for _, m := range metrics {
+				got = append(got, m.Name)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("metrics = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("metrics = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+
+	metrics := Diff(full(200, 5), full(100, 10))
+	for _, m := range metrics {
+		want := map[string]Change{"download": Better, "upload": Worse, "idle_latency": Same}[m.Name]
+		if want != "" && m.Change != want {
+			t.Errorf("%s change = %q, want %q", m.Name, m.Change, want)
+		}
+	}
+}
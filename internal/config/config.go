@@ -0,0 +1,296 @@
+// Package config loads brr's settings from a TOML file and BRR_*
+// environment variables.
+//
+// Settings are layered: built-in defaults, then the config file, then the
+// environment, then command-line flags (applied by the caller). Zero values
+// mean "not set" at every layer, so a later layer only overrides what it
+// sets.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Config is the contents of config.toml.
+type Config struct {
+	Server   string   `toml:"server,omitempty"`  // base URL or named backend, as for --server
+	Echo     string   `toml:"echo,omitempty"`    // UDP echo server, as for --echo
+	Duration Duration `toml:"duration,omitzero"` // time-bounded phases, as for --duration
+	Theme    string   `toml:"theme,omitempty"`
+	Output   string   `toml:"output,omitempty"`  // tui, simple, json or influx
+	Profile  string   `toml:"profile,omitempty"` // as for --profile
+
+	// Engine and Duration tune the standard profile, and so every user
+	// profile based on it.
+	Engine   Engine             `toml:"engine"`
+	History  History            `toml:"history"`
+	Profiles map[string]Profile `toml:"profiles,omitempty"`
+}
+
+// Profile is a user-defined test profile: a built-in profile with some
+// settings changed.
+type Profile struct {
+	Base          string   `toml:"base,omitempty"` // built-in profile to start from; standard if empty
+	Duration      Duration `toml:"duration,omitzero"`
+	FullDuration  bool     `toml:"full_duration,omitempty"` // keep time-bounded phases running after throughput settles
+	NoDownload    bool     `toml:"no_download,omitempty"`
+	NoUpload      bool     `toml:"no_upload,omitempty"`
+	Bidirectional bool     `toml:"bidirectional,omitempty"` // add a phase loading both directions at once
+	Engine
+}
+
+// Engine tunes the speed test. See speedtest.Config.
+type Engine struct {
+	DownloadSequence   []Transfer `toml:"download_sequence,omitempty"`
+	UploadSequence     []Transfer `toml:"upload_sequence,omitempty"`
+	InitialConnections int        `toml:"initial_connections,omitzero"`
+	MaxConnections     int        `toml:"max_connections,omitzero"`
+	LatencyProbes      int        `toml:"latency_probes,omitzero"`
+	LatencyInterval    Duration   `toml:"latency_interval,omitzero"`
+	SetupProbes        int        `toml:"setup_probes,omitzero"`
+}
+
+// Transfer is one step of a transfer sequence: Count transfers of Bytes.
+type Transfer struct {
+	Bytes int `toml:"bytes"`
+	Count int `toml:"count"`
+}
+
+// History configures where history is kept and for how long.
+type History struct {
+	Path         string   `toml:"path,omitempty"` // directory for history.jsonl and its index
+	Keep         int      `toml:"keep,omitzero"`
+	MaxAge       Duration `toml:"max_age,omitzero"`
+	CompactAfter Duration `toml:"compact_after,omitzero"`
+}
+
+// Outputs are the accepted values of Output.
+var Outputs = []string{"tui", "simple", "json", "influx"}
+
+// DefaultPath returns the default config file location, next to the history
+// in the user's config directory.
+func DefaultPath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		configDir = filepath.Join(os.Getenv("HOME"), ".config")
+	}
+	return filepath.Join(configDir, "brr", "config.toml")
+}
+
+// Load reads the config file at path. A missing file is not an error and
+// yields an empty config.
+func Load(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cfg, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Parse decodes a config file. Unknown keys are errors, so that typos don't
+// go unnoticed.
+func Parse(r io.Reader) (*Config, error) {
+	var cfg Config
+	md, err := toml.NewDecoder(r).Decode(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, len(undecoded))
+		for i, k := range undecoded {
+			keys[i] = k.String()
+		}
+		return nil, fmt.Errorf("unknown keys: %s", strings.Join(keys, ", "))
+	}
+	if rest, ok := strings.CutPrefix(cfg.History.Path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			cfg.History.Path = filepath.Join(home, rest)
+		}
+	}
+	return &cfg, cfg.validate()
+}
+
+func (c *Config) validate() error {
+	if c.Output != "" && !contains(Outputs, c.Output) {
+		return fmt.Errorf("output %q: expected one of %s", c.Output, strings.Join(Outputs, ", "))
+	}
+	if c.History.Keep < 0 {
+		return fmt.Errorf("history.keep must not be negative")
+	}
+	if err := c.Engine.validate("engine"); err != nil {
+		return err
+	}
+	for name, p := range c.Profiles {
+		if err := p.Engine.validate("profiles." + name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Engine) validate(section string) error {
+	for _, seq := range [][]Transfer{e.DownloadSequence, e.UploadSequence} {
+		for _, t := range seq {
+			if t.Bytes <= 0 || t.Count <= 0 {
+				return fmt.Errorf("%s: transfer sequence steps need positive bytes and count, got %+v", section, t)
+			}
+		}
+	}
+	for _, n := range []struct {
+		name  string
+		value int
+	}{
+		{"initial_connections", e.InitialConnections},
+		{"max_connections", e.MaxConnections},
+		{"latency_probes", e.LatencyProbes},
+		{"setup_probes", e.SetupProbes},
+	} {
+		if n.value < 0 {
+			return fmt.Errorf("%s.%s must not be negative", section, n.name)
+		}
+	}
+	return nil
+}
+
+// envVars maps BRR_* variables to the setting they override.
+var envVars = []struct {
+	name string
+	set  func(c *Config, v string) error
+}{
+	{"BRR_SERVER", func(c *Config, v string) error { c.Server = v; return nil }},
+	{"BRR_ECHO", func(c *Config, v string) error { c.Echo = v; return nil }},
+	{"BRR_DURATION", func(c *Config, v string) error { return c.Duration.Set(v) }},
+	{"BRR_THEME", func(c *Config, v string) error { c.Theme = v; return nil }},
+	{"BRR_OUTPUT", func(c *Config, v string) error { c.Output = v; return nil }},
+	{"BRR_PROFILE", func(c *Config, v string) error { c.Profile = v; return nil }},
+	{"BRR_INITIAL_CONNECTIONS", intVar(func(c *Config) *int { return &c.Engine.InitialConnections })},
+	{"BRR_MAX_CONNECTIONS", intVar(func(c *Config) *int { return &c.Engine.MaxConnections })},
+	{"BRR_LATENCY_PROBES", intVar(func(c *Config) *int { return &c.Engine.LatencyProbes })},
+	{"BRR_LATENCY_INTERVAL", func(c *Config, v string) error { return c.Engine.LatencyInterval.Set(v) }},
+	{"BRR_SETUP_PROBES", intVar(func(c *Config) *int { return &c.Engine.SetupProbes })},
+	{"BRR_HISTORY_PATH", func(c *Config, v string) error { c.History.Path = v; return nil }},
+	{"BRR_HISTORY_KEEP", intVar(func(c *Config) *int { return &c.History.Keep })},
+	{"BRR_HISTORY_MAX_AGE", func(c *Config, v string) error { return c.History.MaxAge.Set(v) }},
+	{"BRR_HISTORY_COMPACT_AFTER", func(c *Config, v string) error { return c.History.CompactAfter.Set(v) }},
+}
+
+func intVar(field func(*Config) *int) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", v)
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+// ApplyEnv overrides c with the BRR_* variables that are set and non-empty,
+// looked up with getenv.
+func (c *Config) ApplyEnv(getenv func(string) string) error {
+	for _, e := range envVars {
+		v := getenv(e.name)
+		if v == "" {
+			continue
+		}
+		if err := e.set(c, v); err != nil {
+			return fmt.Errorf("%s: %w", e.name, err)
+		}
+	}
+	return c.validate()
+}
+
+// EnvNames returns the names of the environment variables ApplyEnv reads.
+func EnvNames() []string {
+	names := make([]string, len(envVars))
+	for i, e := range envVars {
+		names[i] = e.name
+	}
+	return names
+}
+
+// Encode writes c as TOML.
+func (c *Config) Encode(w io.Writer) error {
+	return toml.NewEncoder(w).Encode(c)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Duration is a time.Duration written like "400ms" or "2h", or as whole days
+// like "90d". It implements pflag.Value, so it also serves as a flag type.
+type Duration time.Duration
+
+// ParseDuration parses a Go duration or a number of days such as "30d".
+// Negative durations are rejected.
+func ParseDuration(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration %q: want a duration like 720h or a number of days like 30d", s)
+	}
+	return d, nil
+}
+
+func (d Duration) String() string {
+	v := time.Duration(d)
+	switch {
+	case v == 0:
+		return ""
+	case v%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", v/(24*time.Hour))
+	default:
+		return v.String()
+	}
+}
+
+func (d *Duration) Set(s string) error {
+	v, err := ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d *Duration) Type() string { return "duration" }
+
+func (d Duration) MarshalText() ([]byte, error) { return []byte(d.String()), nil }
+
+func (d *Duration) UnmarshalText(b []byte) error {
+	if len(b) == 0 {
+		*d = 0
+		return nil
+	}
+	return d.Set(string(b))
+}
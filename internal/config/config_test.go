@@ -0,0 +1,102 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const sample = `
+server = "https://speed.example.com"
+duration = "10s"
+output = "simple"
+
+[engine]
+max_connections = 8
+latency_interval = "250ms"
+download_sequence = [
+  { bytes = 1_000_000, count = 4 },
+  { bytes = 10_000_000, count = 2 },
+]
+
+[history]
+keep = 500
+max_age = "90d"
+
+[profiles.soak]
+base = "thorough"
+duration = "1m"
+max_connections = 64
+
+[profiles.ping]
+base = "latency-only"
+latency_probes = 200
+`
+
+func TestParseAndEnv(t *testing.T) {
+	cfg, err := Parse(strings.NewReader(sample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server != "https://speed.example.com" || cfg.Output != "simple" {
+		t.Errorf("unexpected top level %+v", cfg)
+	}
+	if time.Duration(cfg.Duration) != 10*time.Second || time.Duration(cfg.Engine.LatencyInterval) != 250*time.Millisecond {
+		t.Errorf("durations: %v %v", cfg.Duration, cfg.Engine.LatencyInterval)
+	}
+	if len(cfg.Engine.DownloadSequence) != 2 || cfg.Engine.DownloadSequence[1] != (Transfer{Bytes: 10_000_000, Count: 2}) {
+		t.Errorf("download sequence: %+v", cfg.Engine.DownloadSequence)
+	}
+	soak := cfg.Profiles["soak"]
+	if soak.Base != "thorough" || time.Duration(soak.Duration) != time.Minute || soak.MaxConnections != 64 {
+		t.Errorf("profiles.soak: %+v", soak)
+	}
+	if time.Duration(cfg.History.MaxAge) != 90*24*time.Hour {
+		t.Errorf("max_age: %v", cfg.History.MaxAge)
+	}
+
+	env := map[string]string{
+		"BRR_SERVER":          "cloudflare",
+		"BRR_MAX_CONNECTIONS": "4",
+		"BRR_HISTORY_KEEP":    "", // empty values don't override
+	}
+	if err := cfg.ApplyEnv(func(k string) string { return env[k] }); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server != "cloudflare" || cfg.Engine.MaxConnections != 4 || cfg.History.Keep != 500 {
+		t.Errorf("after env: server=%q max_connections=%d keep=%d", cfg.Server, cfg.Engine.MaxConnections, cfg.History.Keep)
+	}
+
+	env = map[string]string{"BRR_LATENCY_PROBES": "many"}
+	if err := cfg.ApplyEnv(func(k string) string { return env[k] }); err == nil || !strings.Contains(err.Error(), "BRR_LATENCY_PROBES") {
+		t.Errorf("bad env value: got %v", err)
+	}
+
+	var out strings.Builder
+	if err := cfg.Encode(&out); err != nil {
+		t.Fatal(err)
+	}
+	round, err := Parse(strings.NewReader(out.String()))
+	if err != nil {
+		t.Fatalf("re-parsing encoded config: %v\n%s", err, out.String())
+	}
+	if round.History.MaxAge != cfg.History.MaxAge || len(round.Engine.DownloadSequence) != 2 || round.Profiles["ping"].LatencyProbes != 200 {
+		t.Errorf("round trip lost settings:\n%s", out.String())
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, text := range []string{
+		`sever = "typo"`,
+		`output = "xml"`,
+		"[engine]\nmax_connections = -1",
+		`duration = "soon"`,
+		"[engine]\nupload_sequence = [{ bytes = 0, count = 1 }]",
+		"[profiles.x]\nsetup_probes = -1",
+		"[profiles.x]\nmax_conns = 4",
+	} {
+		if _, err := Parse(strings.NewReader(text)); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", text)
+		}
+	}
+}
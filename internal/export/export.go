@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/allenan/brr/internal/speedtest"
 )
@@ -26,7 +27,7 @@ func ToCSV(w io.Writer, results []speedtest.Result) error {
 		"download_mbps", "upload_mbps",
 		"latency_avg_ms", "latency_jitter_ms",
 		"bufferbloat_dl", "bufferbloat_ul",
-		"context",
+		"context", "status",
 	}
 	if err := writer.Write(header); err != nil {
 		return err
@@ -34,17 +35,18 @@ func ToCSV(w io.Writer, results []speedtest.Result) error {
 
 	for _, r := range results {
 		row := []string{
-			r.Timestamp.Format("2006-01-02T15:04:05Z07:00"),
+			r.Timestamp.Format(time.RFC3339),
 			r.Server.Colo,
 			r.Server.ColoCity,
 			r.Server.Location,
-			fmt.Sprintf("%.1f", r.Download.Mbps),
-			fmt.Sprintf("%.1f", r.Upload.Mbps),
+			optionalMbps(r.Download),
+			optionalMbps(r.Upload),
 			fmt.Sprintf("%.1f", r.IdleLatency.Avg),
 			fmt.Sprintf("%.1f", r.IdleLatency.Jitter),
 			string(r.BufferbloatDL),
 			string(r.BufferbloatUL),
 			r.ContextLine,
+			string(r.Status),
 		}
 		if err := writer.Write(row); err != nil {
 			return err
@@ -53,3 +55,125 @@ func ToCSV(w io.Writer, results []speedtest.Result) error {
 
 	return nil
 }
+
+// ToJSONArray writes results as a formatted JSON array.
+func ToJSONArray(w io.Writer, results []speedtest.Result) error {
+	if results == nil {
+		results = []speedtest.Result{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
+
+// ToJSONL writes results as JSON Lines, one compact result per line.
+func ToJSONL(w io.Writer, results []speedtest.Result) error {
+	enc := json.NewEncoder(w)
+	for i := range results {
+		if err := enc.Encode(&results[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ToSamplesCSV writes every raw sample of the results as CSV, one row per
+// throughput or latency sample, tagged with the run's timestamp and the
+// phase it was taken in: idle, download, upload, or for the bidirectional
+// phase bidir_download and bidir_upload (throughput) and bidir (latency).
+// Throughput rows fill mbps; latency rows fill rtt_ms and whichever stage
+// timings the probe saw. elapsed_s is seconds since the run started, for
+// plotting runs on a common axis.
+func ToSamplesCSV(w io.Writer, results []speedtest.Result) error {
+	writer := csv.NewWriter(w)
+	defer writer.Flush()
+
+	header := []string{
+		"run_timestamp", "server_colo", "phase", "kind",
+		"timestamp", "elapsed_s",
+		"mbps", "rtt_ms", "dns_ms", "connect_ms", "tls_ms", "ttfb_ms",
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, r := range results {
+		run := r.Timestamp.Format(time.RFC3339)
+		prefix := func(phase, kind string, ts time.Time) []string {
+			return []string{
+				run, r.Server.Colo, phase, kind,
+				ts.Format(time.RFC3339Nano),
+				fmt.Sprintf("%.3f", ts.Sub(r.Timestamp).Seconds()),
+			}
+		}
+
+		throughput := []struct {
+			phase  string
+			result *speedtest.PhaseResult
+		}{
+			{"download", r.Download},
+			{"upload", r.Upload},
+			{"bidir_download", r.BidirDownload},
+			{"bidir_upload", r.BidirUpload},
+		}
+		for _, t := range throughput {
+			if t.result == nil {
+				continue
+			}
+			for _, s := range t.result.Samples {
+				row := append(prefix(t.phase, "throughput", s.Timestamp),
+					fmt.Sprintf("%.2f", s.Mbps), "", "", "", "", "")
+				if err := writer.Write(row); err != nil {
+					return err
+				}
+			}
+		}
+
+		latency := []struct {
+			phase  string
+			result *speedtest.LatencyResult
+		}{
+			{"idle", &r.IdleLatency},
+			{"download", r.DownloadLatency},
+			{"upload", r.UploadLatency},
+			{"bidir", r.BidirLatency},
+		}
+		for _, l := range latency {
+			if l.result == nil {
+				continue
+			}
+			for _, s := range l.result.Samples {
+				row := append(prefix(l.phase, "latency", s.Timestamp),
+					"", fmt.Sprintf("%.2f", s.RTT),
+					optionalMs(s.DNS), optionalMs(s.Connect), optionalMs(s.TLS), optionalMs(s.TTFB))
+				if err := writer.Write(row); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// optionalMbps formats a phase's speed, leaving skipped phases empty.
+func optionalMbps(p *speedtest.PhaseResult) string {
+	if p == nil {
+		return ""
+	}
+	return fmt.Sprintf("%.1f", p.Mbps)
+}
+
+// optionalMs formats a stage timing, leaving stages that didn't occur empty.
+func optionalMs(v float64) string {
+	if v == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%.2f", v)
+}
+
+// Filename returns a default export file name for result, unique to the
+// second it ran, e.g. brr-20240315-142233.json.
+func Filename(result *speedtest.Result, ext string) string {
+	return "brr-" + result.Timestamp.Local().Format("20060102-150405") + "." + ext
+}
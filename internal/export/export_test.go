@@ -0,0 +1,140 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/allenan/brr/internal/speedtest"
+)
+
+// sampledResults returns two runs: one with idle latency, download and
+// upload samples, and one that skipped upload.
+func sampledResults() []speedtest.Result {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+	throughput := func(mbps ...float64) *speedtest.PhaseResult {
+		p := &speedtest.PhaseResult{Mbps: mbps[len(mbps)-1]}
+		for i, v := range mbps {
+			p.Samples = append(p.Samples, speedtest.Sample{Timestamp: at(1000 + 100*i), Mbps: v})
+		}
+		return p
+	}
+	latency := func(n int) *speedtest.LatencyResult {
+		l := &speedtest.LatencyResult{Avg: 20}
+		for i := 0; i < n; i++ {
+			l.Samples = append(l.Samples, speedtest.LatencySample{Timestamp: at(10 * i), RTT: 20, TTFB: 18})
+		}
+		return l
+	}
+
+	full := speedtest.Result{
+		Timestamp:       start,
+		Status:          speedtest.StatusOK,
+		Server:          speedtest.ServerInfo{Colo: "SEA"},
+		IdleLatency:     *latency(3),
+		Download:        throughput(100, 200, 300),
+		DownloadLatency: latency(2),
+		Upload:          throughput(10, 20),
+		UploadLatency:   latency(1),
+	}
+	downloadOnly := full
+	downloadOnly.Timestamp = start.Add(time.Hour)
+	downloadOnly.Upload, downloadOnly.UploadLatency = nil, nil
+	return []speedtest.Result{full, downloadOnly}
+}
+
+func TestToSamplesCSV(t *testing.T) {
+	var b strings.Builder
+	if err := ToSamplesCSV(&b, sampledResults()); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(strings.NewReader(b.String())).ReadAll()
+	if err != nil {
+		t.Fatalf("output isn't CSV: %v\n%s", err, b.String())
+	}
+
+	wantHeader := "run_timestamp,server_colo,phase,kind,timestamp,elapsed_s,mbps,rtt_ms,dns_ms,connect_ms,tls_ms,ttfb_ms"
+	if got := strings.Join(rows[0], ","); got != wantHeader {
+		t.Errorf("header = %s, want %s", got, wantHeader)
+	}
+
+	counts := map[string]int{}
+	for _, row := range rows[1:] {
+		if len(row) != len(rows[0]) {
+			t.Fatalf("row %v has %d fields, want %d", row, len(row), len(rows[0]))
+		}
+		counts[row[0][11:19]+" "+row[2]+" "+row[3]]++
+	}
+	want := map[string]int{
+		"12:00:00 download throughput": 3,
+		"12:00:00 upload throughput":   2,
+		"12:00:00 idle latency":        3,
+		"12:00:00 download latency":    2,
+		"12:00:00 upload latency":      1,
+		"13:00:00 download throughput": 3,
+		"13:00:00 idle latency":        3,
+		"13:00:00 download latency":    2,
+	}
+	if len(counts) != len(want) {
+		t.Errorf("rows by run, phase and kind = %v, want %v", counts, want)
+	}
+	for k, n := range want {
+		if counts[k] != n {
+			t.Errorf("%s: %d rows, want %d", k, counts[k], n)
+		}
+	}
+
+	// The second download sample, 1.1s into the run
+	if got := strings.Join(rows[2][5:8], ","); got != "1.100,200.00," {
+		t.Errorf("elapsed_s,mbps,rtt_ms = %s, want 1.100,200.00,", got)
+	}
+}
+
+func TestToJSONL(t *testing.T) {
+	var b strings.Builder
+	if err := ToJSONL(&b, sampledResults()); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("%d lines, want one per result:\n%s", len(lines), b.String())
+	}
+	for i, line := range lines {
+		var r speedtest.Result
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("line %d isn't a JSON object: %v", i, err)
+		}
+		if r.Download == nil || r.Download.Mbps != 300 {
+			t.Errorf("line %d download = %+v, want 300 Mbps", i, r.Download)
+		}
+		if (r.Upload != nil) != (i == 0) {
+			t.Errorf("line %d upload = %+v", i, r.Upload)
+		}
+	}
+}
+
+func TestToJSONArray(t *testing.T) {
+	var b strings.Builder
+	if err := ToJSONArray(&b, sampledResults()); err != nil {
+		t.Fatal(err)
+	}
+	var results []speedtest.Result
+	if err := json.Unmarshal([]byte(b.String()), &results); err != nil {
+		t.Fatalf("output isn't a JSON array: %v", err)
+	}
+	if len(results) != 2 || !results[1].Timestamp.Equal(results[0].Timestamp.Add(time.Hour)) {
+		t.Errorf("results = %+v, want both runs in order", results)
+	}
+
+	// No runs is an empty array, not null
+	b.Reset()
+	if err := ToJSONArray(&b, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(b.String()); got != "[]" {
+		t.Errorf("no results = %s, want []", got)
+	}
+}
@@ -0,0 +1,118 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/allenan/brr/internal/speedtest"
+)
+
+// tagEscaper escapes tag values per the InfluxDB line protocol.
+var tagEscaper = strings.NewReplacer(`\`, `\\`, ",", `\,`, "=", `\=`, " ", `\ `)
+
+// fieldEscaper escapes string field values per the InfluxDB line protocol.
+var fieldEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// ToInflux writes the result as one InfluxDB line protocol point in the
+// "brr" measurement, tagged with the server's colo and location, the client
+// IP and the address family, timestamped in nanoseconds. Throughput and
+// latency fields are prefixed by phase (idle, download, upload, and bidir
+// for the bidirectional phase) and only present for phases that ran.
+// Bufferbloat grades are written both as strings and as scores, 5 (A+)
+// through 0 (F).
+func ToInflux(w io.Writer, result *speedtest.Result) error {
+	var tags strings.Builder
+	tags.WriteString("brr")
+	for _, t := range []struct{ key, value string }{
+		{"colo", result.Server.Colo},
+		{"location", result.Server.Location},
+		{"ip", result.Server.IP},
+		{"family", string(result.Server.AddressFamily)},
+	} {
+		if t.value != "" { // empty tag values are invalid
+			tags.WriteString("," + t.key + "=" + tagEscaper.Replace(t.value))
+		}
+	}
+
+	f := &influxFields{}
+	transfers := []struct {
+		name   string
+		result *speedtest.PhaseResult
+	}{
+		{"download", result.Download},
+		{"upload", result.Upload},
+		{"bidir_download", result.BidirDownload},
+		{"bidir_upload", result.BidirUpload},
+	}
+	for _, ph := range transfers {
+		if ph.result != nil {
+			f.float(ph.name+"_mbps", ph.result.Mbps)
+		}
+	}
+	for _, ph := range transfers {
+		if ph.result != nil {
+			f.int(ph.name+"_connections", ph.result.Connections)
+		}
+	}
+
+	for _, ph := range []struct {
+		name    string
+		latency *speedtest.LatencyResult
+	}{
+		{"idle", &result.IdleLatency},
+		{"download", result.DownloadLatency},
+		{"upload", result.UploadLatency},
+		{"bidir", result.BidirLatency},
+	} {
+		if ph.latency == nil || len(ph.latency.Samples) == 0 {
+			continue
+		}
+		f.float(ph.name+"_latency_min_ms", ph.latency.Min)
+		f.float(ph.name+"_latency_avg_ms", ph.latency.Avg)
+		f.float(ph.name+"_latency_max_ms", ph.latency.Max)
+		f.float(ph.name+"_latency_jitter_ms", ph.latency.Jitter)
+		if ph.latency.Loss != nil {
+			f.float(ph.name+"_packet_loss_pct", ph.latency.Loss.LossPct)
+		}
+	}
+
+	for _, g := range []struct {
+		direction string
+		grade     speedtest.BufferbloatGrade
+	}{
+		{"download", result.BufferbloatDL},
+		{"upload", result.BufferbloatUL},
+		{"bidir", result.BufferbloatBidir},
+	} {
+		if score := g.grade.Score(); score >= 0 {
+			f.string("bufferbloat_"+g.direction, string(g.grade))
+			f.int("bufferbloat_"+g.direction+"_score", score)
+		}
+	}
+
+	if r := result.Responsiveness; r != nil {
+		f.float("responsiveness_rpm", r.RPM)
+	}
+
+	_, err := fmt.Fprintf(w, "%s %s %d\n", tags.String(), strings.Join(f.fields, ","), result.Timestamp.UnixNano())
+	return err
+}
+
+// influxFields accumulates line protocol fields in order.
+type influxFields struct {
+	fields []string
+}
+
+func (f *influxFields) float(key string, v float64) {
+	f.fields = append(f.fields, key+"="+strconv.FormatFloat(v, 'f', -1, 64))
+}
+
+func (f *influxFields) int(key string, v int) {
+	f.fields = append(f.fields, key+"="+strconv.Itoa(v)+"i")
+}
+
+func (f *influxFields) string(key, v string) {
+	f.fields = append(f.fields, key+`="`+fieldEscaper.Replace(v)+`"`)
+}
@@ -0,0 +1,57 @@
+package export
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/allenan/brr/internal/speedtest"
+)
+
+func TestToInflux(t *testing.T) {
+	result := &speedtest.Result{
+		Timestamp: time.Unix(1700000000, 5),
+		Server:    speedtest.ServerInfo{IP: "203.0.113.7", Colo: "SEA", Location: "New York, US"},
+		Download:  &speedtest.PhaseResult{Mbps: 250.5, Connections: 6},
+		Upload:    &speedtest.PhaseResult{Mbps: 20, Connections: 2},
+		IdleLatency: speedtest.LatencyResult{
+			Min: 10, Avg: 12.5, Max: 15, Jitter: 1.25,
+			Samples: []speedtest.LatencySample{{RTT: 12.5}},
+		},
+		BufferbloatDL: speedtest.GradeB,
+	}
+
+	var b strings.Builder
+	if err := ToInflux(&b, result); err != nil {
+		t.Fatal(err)
+	}
+	line := b.String()
+
+	want := `brr,colo=SEA,location=New\ York\,\ US,ip=203.0.113.7 ` +
+		`download_mbps=250.5,upload_mbps=20,download_connections=6i,upload_connections=2i,` +
+		`idle_latency_min_ms=10,idle_latency_avg_ms=12.5,idle_latency_max_ms=15,idle_latency_jitter_ms=1.25,` +
+		`bufferbloat_download="B",bufferbloat_download_score=3i ` +
+		"1700000000000000005\n"
+	if line != want {
+		t.Errorf("got\n%s\nwant\n%s", line, want)
+	}
+
+	// Skipped phases leave their fields out
+	result.Upload = nil
+	b.Reset()
+	if err := ToInflux(&b, result); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(b.String(), "upload_") {
+		t.Errorf("upload fields written for a run without upload:\n%s", b.String())
+	}
+
+	result.Server.AddressFamily = speedtest.FamilyIPv6
+	b.Reset()
+	if err := ToInflux(&b, result); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(b.String(), `brr,colo=SEA,location=New\ York\,\ US,ip=203.0.113.7,family=ipv6 `) {
+		t.Errorf("family tag missing:\n%s", b.String())
+	}
+}
@@ -0,0 +1,140 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/allenan/brr/internal/speedtest"
+)
+
+// labelEscaper escapes label values per the Prometheus text format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// ToPrometheus writes the result as gauges in the Prometheus text exposition
+// format. Every sample is labeled with the server's colo and location.
+// Bufferbloat grades are exported as their score, 5 (A+) through 0 (F).
+func ToPrometheus(w io.Writer, result *speedtest.Result) error {
+	p := &promWriter{
+		w:      w,
+		labels: fmt.Sprintf(`colo="%s",location="%s"`, labelEscaper.Replace(result.Server.Colo), labelEscaper.Replace(result.Server.Location)),
+	}
+
+	p.family("brr_test_timestamp_seconds", "Unix time the speed test started.")
+	p.sample("brr_test_timestamp_seconds", "", float64(result.Timestamp.Unix()))
+
+	// Skipped phases have no samples
+	if result.Download != nil {
+		p.family("brr_download_mbps", "Download speed in megabits per second (P90).")
+		p.sample("brr_download_mbps", "", result.Download.Mbps)
+	}
+	if result.Upload != nil {
+		p.family("brr_upload_mbps", "Upload speed in megabits per second (P90).")
+		p.sample("brr_upload_mbps", "", result.Upload.Mbps)
+	}
+
+	if result.BidirDownload != nil && result.BidirUpload != nil {
+		p.family("brr_bidir_mbps", "Speed in megabits per second (P90) while downloading and uploading at the same time.")
+		p.sample("brr_bidir_mbps", `direction="download"`, result.BidirDownload.Mbps)
+		p.sample("brr_bidir_mbps", `direction="upload"`, result.BidirUpload.Mbps)
+	}
+
+	p.family("brr_connections", "Parallel connections used at saturation.")
+	if result.Download != nil {
+		p.sample("brr_connections", `direction="download"`, float64(result.Download.Connections))
+	}
+	if result.Upload != nil {
+		p.sample("brr_connections", `direction="upload"`, float64(result.Upload.Connections))
+	}
+
+	phases := []struct {
+		name    string
+		latency *speedtest.LatencyResult
+	}{
+		{"idle", &result.IdleLatency},
+		{"download", result.DownloadLatency},
+		{"upload", result.UploadLatency},
+		{"bidir", result.BidirLatency},
+	}
+	stats := []struct {
+		name string
+		help string
+		stat func(*speedtest.LatencyResult) float64
+	}{
+		{"brr_latency_min_ms", "Minimum latency in milliseconds.", func(l *speedtest.LatencyResult) float64 { return l.Min }},
+		{"brr_latency_avg_ms", "Average latency in milliseconds.", func(l *speedtest.LatencyResult) float64 { return l.Avg }},
+		{"brr_latency_max_ms", "Maximum latency in milliseconds.", func(l *speedtest.LatencyResult) float64 { return l.Max }},
+		{"brr_latency_jitter_ms", "Latency jitter in milliseconds.", func(l *speedtest.LatencyResult) float64 { return l.Jitter }},
+	}
+	for _, st := range stats {
+		p.family(st.name, st.help+" Phase idle is unloaded; download, upload and bidir (both at once) are under load.")
+		for _, ph := range phases {
+			if ph.latency == nil || len(ph.latency.Samples) == 0 {
+				continue
+			}
+			p.sample(st.name, `phase="`+ph.name+`"`, st.stat(ph.latency))
+		}
+	}
+
+	p.family("brr_bufferbloat_grade", "Bufferbloat grade as a score: 5 (A+) through 0 (F).")
+	for _, g := range []struct {
+		direction string
+		grade     speedtest.BufferbloatGrade
+	}{
+		{"download", result.BufferbloatDL},
+		{"upload", result.BufferbloatUL},
+		{"bidir", result.BufferbloatBidir},
+	} {
+		if score := g.grade.Score(); score >= 0 {
+			p.sample("brr_bufferbloat_grade", `direction="`+g.direction+`"`, float64(score))
+		}
+	}
+
+	if r := result.Responsiveness; r != nil {
+		p.family("brr_responsiveness_rpm", "Round-trips per minute under load (IETF responsiveness).")
+		p.sample("brr_responsiveness_rpm", "", r.RPM)
+	}
+
+	var hasLoss bool
+	for _, ph := range phases {
+		hasLoss = hasLoss || (ph.latency != nil && ph.latency.Loss != nil)
+	}
+	if hasLoss {
+		p.family("brr_packet_loss_pct", "UDP echo packet loss in percent.")
+		for _, ph := range phases {
+			if ph.latency != nil && ph.latency.Loss != nil {
+				p.sample("brr_packet_loss_pct", `phase="`+ph.name+`"`, ph.latency.Loss.LossPct)
+			}
+		}
+	}
+
+	return p.err
+}
+
+// promWriter writes gauge families with a common label set, remembering the
+// first write error.
+type promWriter struct {
+	w      io.Writer
+	labels string
+	err    error
+}
+
+func (p *promWriter) family(name, help string) {
+	p.printf("# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+}
+
+func (p *promWriter) sample(name, extraLabels string, v float64) {
+	labels := p.labels
+	if extraLabels != "" {
+		labels += "," + extraLabels
+	}
+	p.printf("%s{%s} %s\n", name, labels, strconv.FormatFloat(v, 'g', -1, 64))
+}
+
+func (p *promWriter) printf(format string, args ...any) {
+	if p.err != nil {
+		return
+	}
+	_, p.err = fmt.Fprintf(p.w, format, args...)
+}
@@ -0,0 +1,34 @@
+package export
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/allenan/brr/internal/speedtest"
+)
+
+// WriteTextfile writes the result in Prometheus text format to path, for the
+// node_exporter textfile collector. The file is written under a temporary
+// name and renamed into place, so the collector never reads a partial file.
+// The temporary name doesn't end in .prom, which the collector ignores.
+func WriteTextfile(path string, result *speedtest.Result) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	err = ToPrometheus(f, result)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, 0o644) // readable by node_exporter
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
@@ -0,0 +1,159 @@
+// Package exporter serves speed test results as Prometheus metrics.
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/allenan/brr/internal/export"
+	"github.com/allenan/brr/internal/speedtest"
+)
+
+// DefaultMinInterval is the default minimum time between tests in on-scrape
+// mode. Speed tests saturate the link, so scrapes in between get the cache.
+const DefaultMinInterval = 5 * time.Minute
+
+// runTimeout bounds a single test run started by a scrape.
+const runTimeout = 2 * time.Minute
+
+// Exporter runs speed tests and serves the latest result on /metrics.
+//
+// With Interval set, tests run on that schedule from Run and scrapes only
+// read the cache. Otherwise a scrape starts a test when the cached result is
+// older than MinInterval; concurrent scrapes wait for the same run.
+type Exporter struct {
+	Engine      *speedtest.Engine
+	Interval    time.Duration // scheduled mode: time between tests (0 = test on scrape)
+	MinInterval time.Duration // on-scrape mode: minimum time between tests
+
+	runMu sync.Mutex // serializes test runs
+
+	mu       sync.Mutex // guards the fields below
+	last     *speedtest.Result
+	lastRun  time.Time
+	lastErr  error
+	runs     int
+	failures int
+}
+
+// New returns an on-scrape exporter for engine with the default minimum
+// interval.
+func New(engine *speedtest.Engine) *Exporter {
+	return &Exporter{
+		Engine:      engine,
+		MinInterval: DefaultMinInterval,
+	}
+}
+
+// Run tests on the configured schedule until ctx is cancelled. In on-scrape
+// mode it returns immediately.
+func (e *Exporter) Run(ctx context.Context) {
+	if e.Interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(e.Interval)
+	defer ticker.Stop()
+
+	for {
+		e.runTest(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Handler returns an http.Handler serving /metrics.
+func (e *Exporter) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", e.serveMetrics)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintln(w, "brr exporter: metrics at /metrics")
+	})
+	return mux
+}
+
+func (e *Exporter) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	if e.Interval <= 0 && e.stale() {
+		// Keep running if the scraper gives up so the next scrape gets the result
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), runTimeout)
+		e.runTest(ctx)
+		cancel()
+	}
+
+	e.mu.Lock()
+	last, lastErr, runs, failures := e.last, e.lastErr, e.runs, e.failures
+	e.mu.Unlock()
+
+	var buf bytes.Buffer
+	if last != nil {
+		if err := export.ToPrometheus(&buf, last); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	success := 0
+	if runs > 0 && lastErr == nil {
+		success = 1
+	}
+	fmt.Fprintf(&buf, "# HELP brr_last_run_success Whether the most recent speed test succeeded.\n# TYPE brr_last_run_success gauge\nbrr_last_run_success %d\n", success)
+	fmt.Fprintf(&buf, "# HELP brr_runs_total Speed tests started by this exporter.\n# TYPE brr_runs_total counter\nbrr_runs_total %d\n", runs)
+	fmt.Fprintf(&buf, "# HELP brr_run_failures_total Speed tests that failed.\n# TYPE brr_run_failures_total counter\nbrr_run_failures_total %d\n", failures)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// stale reports whether the cache is due for a new test in on-scrape mode.
+func (e *Exporter) stale() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.lastRun.IsZero() || time.Since(e.lastRun) >= e.MinInterval
+}
+
+// runTest runs one speed test and caches its result. A caller that waited
+// behind another run skips its own if the cache became fresh meanwhile.
+func (e *Exporter) runTest(ctx context.Context) {
+	started := time.Now()
+	e.runMu.Lock()
+	defer e.runMu.Unlock()
+
+	e.mu.Lock()
+	fresh := e.lastRun.After(started)
+	e.mu.Unlock()
+	if fresh {
+		return
+	}
+
+	result, err := e.Engine.Run(ctx, nopCallback{})
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.runs++
+	e.lastRun = time.Now()
+	e.lastErr = err
+	if err != nil {
+		e.failures++
+		return
+	}
+	e.last = result
+}
+
+type nopCallback struct{}
+
+func (nopCallback) OnPhase(speedtest.Phase)                       {}
+func (nopCallback) OnDownloadSample(speedtest.Sample)             {}
+func (nopCallback) OnUploadSample(speedtest.Sample)               {}
+func (nopCallback) OnIdleLatencySample(speedtest.LatencySample)   {}
+func (nopCallback) OnLoadedLatencySample(speedtest.LatencySample) {}
@@ -0,0 +1,64 @@
+package exporter
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/allenan/brr/internal/server"
+	"github.com/allenan/brr/internal/speedtest"
+)
+
+func TestScrapeRunsTestAndCaches(t *testing.T) {
+	testSrv := httptest.NewServer(server.Handler(server.Options{Colo: "lab", Location: "US"}))
+	defer testSrv.Close()
+
+	backend, err := speedtest.ParseBackend(testSrv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := speedtest.NewEngine(backend)
+	engine.Config = speedtest.Config{
+		DownloadSequence: []speedtest.TransferSpec{{Bytes: 100_000, Count: 2}},
+		UploadSequence:   []speedtest.TransferSpec{{Bytes: 10_000, Count: 2}},
+		MaxConnections:   2,
+		SampleInterval:   10 * time.Millisecond,
+		LatencyProbes:    3,
+		LatencyInterval:  10 * time.Millisecond,
+	}
+
+	exp := New(engine)
+	srv := httptest.NewServer(exp.Handler())
+	defer srv.Close()
+
+	scrape := func() string {
+		t.Helper()
+		resp, err := http.Get(srv.URL + "/metrics")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	first := scrape()
+	for _, want := range []string{
+		`brr_download_mbps{colo="lab",location="US"} `,
+		`brr_latency_avg_ms{colo="lab",location="US",phase="idle"} `,
+		"brr_last_run_success 1\n",
+		"brr_runs_total 1\n",
+	} {
+		if !strings.Contains(first, want) {
+			t.Errorf("metrics missing %q:\n%s", want, first)
+		}
+	}
+
+	// Within MinInterval the cached result is served without a new run
+	if second := scrape(); !strings.Contains(second, "brr_runs_total 1\n") {
+		t.Errorf("second scrape started a new run:\n%s", second)
+	}
+}
@@ -0,0 +1,120 @@
+package history
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+)
+
+// indexRecordSize is the on-disk size of an indexRecord: three little-endian
+// int64s.
+const indexRecordSize = 24
+
+// indexRecord locates one history.jsonl line.
+type indexRecord struct {
+	Timestamp int64 // Result.Timestamp in Unix nanoseconds
+	Offset    int64 // byte offset of the line
+	Length    int64 // line length including the newline
+}
+
+// loadIndex reads the index, rebuilding it from history.jsonl if it is
+// missing, damaged, or doesn't end where history.jsonl does (e.g. after a
+// crash between the two appends, or a file edited by hand). Callers hold the
+// store lock.
+func (s *Store) loadIndex() ([]indexRecord, error) {
+	info, err := os.Stat(s.path())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(s.indexPath())
+	if err == nil && len(data)%indexRecordSize == 0 {
+		idx := decodeIndex(data)
+		var end int64
+		if len(idx) > 0 {
+			last := idx[len(idx)-1]
+			end = last.Offset + last.Length
+		}
+		if end == info.Size() {
+			return idx, nil
+		}
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	return s.rebuildIndex()
+}
+
+// rebuildIndex scans history.jsonl and rewrites the index. Lines that don't
+// parse are left out.
+func (s *Store) rebuildIndex() ([]indexRecord, error) {
+	f, err := os.Open(s.path())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var idx []indexRecord
+	err = scanLines(f, func(offset, length int64, line []byte) {
+		var entry struct {
+			Timestamp time.Time `json:"timestamp"`
+		}
+		if json.Unmarshal(line, &entry) != nil {
+			return
+		}
+		idx = append(idx, indexRecord{
+			Timestamp: entry.Timestamp.UnixNano(),
+			Offset:    offset,
+			Length:    length,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeFileAtomic(s.indexPath(), encodeIndex(idx...)); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// appendIndex appends rec to the index file.
+func (s *Store) appendIndex(rec indexRecord) error {
+	f, err := os.OpenFile(s.indexPath(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(encodeIndex(rec)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func encodeIndex(recs ...indexRecord) []byte {
+	buf := make([]byte, 0, len(recs)*indexRecordSize)
+	for _, r := range recs {
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(r.Timestamp))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(r.Offset))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(r.Length))
+	}
+	return buf
+}
+
+func decodeIndex(data []byte) []indexRecord {
+	idx := make([]indexRecord, len(data)/indexRecordSize)
+	for i := range idx {
+		b := data[i*indexRecordSize:]
+		idx[i] = indexRecord{
+			Timestamp: int64(binary.LittleEndian.Uint64(b[0:])),
+			Offset:    int64(binary.LittleEndian.Uint64(b[8:])),
+			Length:    int64(binary.LittleEndian.Uint64(b[16:])),
+		}
+	}
+	return idx
+}
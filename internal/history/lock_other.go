@@ -0,0 +1,9 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !windows
+
+package history
+
+// lockFile is a no-op on platforms without advisory file locks; concurrent
+// writers from separate processes are not coordinated there.
+func lockFile(path string) (unlock func(), err error) {
+	return func() {}, nil
+}
@@ -0,0 +1,51 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/allenan/brr/internal/speedtest"
+)
+
+// migrate converts the history.json array written by earlier versions into
+// history.jsonl the first time the store is used. The old file is kept as
+// history.json.bak. Callers hold the store lock.
+func (s *Store) migrate() error {
+	if _, err := os.Stat(s.path()); err == nil || !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	data, err := os.ReadFile(s.legacyPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var entries []speedtest.Result
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("migrating %s: %w", s.legacyPath(), err)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+
+	var buf []byte
+	for _, e := range entries {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("migrating %s: %w", s.legacyPath(), err)
+		}
+		buf = append(buf, line...)
+		buf = append(buf, '\n')
+	}
+
+	if err := writeFileAtomic(s.path(), buf); err != nil {
+		return err
+	}
+	return os.Rename(s.legacyPath(), s.legacyPath()+".bak")
+}
@@ -0,0 +1,203 @@
+package history
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/allenan/brr/internal/speedtest"
+)
+
+// Query selects history entries. Zero fields don't filter.
+type Query struct {
+	Since  time.Time
+	Until  time.Time
+	Colos  []string                     // matched case-insensitively
+	Grades []speedtest.BufferbloatGrade // download bufferbloat grade
+	Limit  int                          // most recent matches only
+}
+
+// Query returns the entries matching q, most recent first. Colo and grade
+// filters only match completed runs.
+func (s *Store) Query(q Query) ([]speedtest.Result, error) {
+	entries, err := s.Range(q.Since, q.Until)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []speedtest.Result
+	for _, e := range entries {
+		if q.Limit > 0 && len(out) == q.Limit {
+			break
+		}
+		if len(q.Colos) > 0 && !containsFold(q.Colos, e.Server.Colo) {
+			continue
+		}
+		if len(q.Grades) > 0 && !containsGrade(q.Grades, e.BufferbloatDL) {
+			continue
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsGrade(list []speedtest.BufferbloatGrade, g speedtest.BufferbloatGrade) bool {
+	for _, v := range list {
+		if strings.EqualFold(string(v), string(g)) {
+			return true
+		}
+	}
+	return false
+}
+
+// GroupBy selects how Summarize buckets entries.
+type GroupBy string
+
+const (
+	GroupNone GroupBy = ""
+	GroupDay  GroupBy = "day"  // calendar day, local time
+	GroupHour GroupBy = "hour" // hour of day across all days, local time
+	GroupColo GroupBy = "colo"
+)
+
+// ParseGroupBy validates a --group-by value.
+func ParseGroupBy(s string) (GroupBy, error) {
+	switch g := GroupBy(strings.ToLower(s)); g {
+	case GroupNone, GroupDay, GroupHour, GroupColo:
+		return g, nil
+	default:
+		return "", fmt.Errorf("unknown grouping %q: expected day, hour or colo", s)
+	}
+}
+
+// MetricSummary is the distribution of one metric within a group.
+type MetricSummary struct {
+	Metric string  `json:"metric"`
+	Unit   string  `json:"unit"`
+	Min    float64 `json:"min"`
+	Median float64 `json:"median"`
+	P90    float64 `json:"p90"`
+	Max    float64 `json:"max"`
+}
+
+// GroupStats summarizes the runs in one group.
+type GroupStats struct {
+	Group   string          `json:"group"`
+	Runs    int             `json:"runs"`
+	Failed  int             `json:"failed"`
+	Metrics []MetricSummary `json:"metrics"`
+}
+
+// summaryMetrics are the metrics Summarize reports, in order.
+var summaryMetrics = []struct {
+	name  string
+	unit  string
+	value func(speedtest.Result) (v float64, ok bool) // ok is false if the run skipped the phase
+}{
+	{"download", "Mbps", func(r speedtest.Result) (float64, bool) {
+		if r.Download == nil {
+			return 0, false
+		}
+		return r.Download.Mbps, true
+	}},
+	{"upload", "Mbps", func(r speedtest.Result) (float64, bool) {
+		if r.Upload == nil {
+			return 0, false
+		}
+		return r.Upload.Mbps, true
+	}},
+	{"idle_latency", "ms", func(r speedtest.Result) (float64, bool) { return r.IdleLatency.Avg, true }},
+	{"jitter", "ms", func(r speedtest.Result) (float64, bool) { return r.IdleLatency.Jitter, true }},
+	{"download_latency", "ms", func(r speedtest.Result) (float64, bool) {
+		if r.DownloadLatency == nil {
+			return 0, false
+		}
+		return r.DownloadLatency.Avg, true
+	}},
+	{"upload_latency", "ms", func(r speedtest.Result) (float64, bool) {
+		if r.UploadLatency == nil {
+			return 0, false
+		}
+		return r.UploadLatency.Avg, true
+	}},
+}
+
+// Summarize computes min, median, P90 and max of each metric per group,
+// over completed runs; failed runs are only counted. Groups are sorted by
+// key.
+func Summarize(entries []speedtest.Result, by GroupBy) []GroupStats {
+	groups := make(map[string][]speedtest.Result)
+	failed := make(map[string]int)
+	for _, e := range entries {
+		key := groupKey(e, by)
+		if !e.Status.OK() {
+			failed[key]++
+			if _, ok := groups[key]; !ok {
+				groups[key] = nil
+			}
+			continue
+		}
+		groups[key] = append(groups[key], e)
+	}
+
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := make([]GroupStats, 0, len(keys))
+	for _, k := range keys {
+		runs := groups[k]
+		gs := GroupStats{Group: k, Runs: len(runs) + failed[k], Failed: failed[k]}
+		if len(runs) > 0 {
+			for _, m := range summaryMetrics {
+				var vals []float64
+				for _, r := range runs {
+					if v, ok := m.value(r); ok {
+						vals = append(vals, v)
+					}
+				}
+				if len(vals) == 0 {
+					continue
+				}
+				gs.Metrics = append(gs.Metrics, MetricSummary{
+					Metric: m.name,
+					Unit:   m.unit,
+					Min:    speedtest.Percentile(vals, 0),
+					Median: speedtest.Median(vals),
+					P90:    speedtest.Percentile(vals, 0.90),
+					Max:    speedtest.Percentile(vals, 1),
+				})
+			}
+		}
+		out = append(out, gs)
+	}
+	return out
+}
+
+func groupKey(e speedtest.Result, by GroupBy) string {
+	switch by {
+	case GroupDay:
+		return e.Timestamp.Local().Format("2006-01-02")
+	case GroupHour:
+		return e.Timestamp.Local().Format("15") + ":00"
+	case GroupColo:
+		if e.Server.Colo == "" {
+			return "—"
+		}
+		return e.Server.Colo
+	default:
+		return "all"
+	}
+}
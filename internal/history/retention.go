@@ -0,0 +1,160 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/allenan/brr/internal/speedtest"
+)
+
+// Retention limits how much history is kept. Zero fields mean no limit.
+type Retention struct {
+	MaxEntries   int           // keep at most this many of the newest entries
+	MaxAge       time.Duration // remove entries older than this
+	CompactAfter time.Duration // drop raw samples from entries older than this
+}
+
+// PruneStats reports what a prune changed.
+type PruneStats struct {
+	Removed     int
+	Compacted   int
+	Kept        int
+	BytesBefore int64
+	BytesAfter  int64
+}
+
+// Reclaimed returns the number of bytes freed.
+func (p *PruneStats) Reclaimed() int64 {
+	return p.BytesBefore - p.BytesAfter
+}
+
+// Prune applies r to the whole history, rewriting it if anything changes.
+func (s *Store) Prune(r Retention) (*PruneStats, error) {
+	unlock, err := s.lockExisting()
+	if err != nil || unlock == nil {
+		return &PruneStats{}, err
+	}
+	defer unlock()
+
+	if err := s.migrate(); err != nil {
+		return nil, err
+	}
+	return s.prune(r, time.Now())
+}
+
+// overRetention reports whether the history described by idx exceeds the
+// entry or age limits of r, so that Save only rewrites when there is work.
+func overRetention(r Retention, idx []indexRecord, now time.Time) bool {
+	if r.MaxEntries > 0 && len(idx) > r.MaxEntries {
+		return true
+	}
+	if r.MaxAge > 0 {
+		cutoff := now.Add(-r.MaxAge).UnixNano()
+		for _, rec := range idx {
+			if rec.Timestamp < cutoff {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// prune rewrites history.jsonl under r. Callers hold the store lock.
+func (s *Store) prune(r Retention, now time.Time) (*PruneStats, error) {
+	f, err := os.Open(s.path())
+	if errors.Is(err, os.ErrNotExist) {
+		return &PruneStats{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	stats := &PruneStats{BytesBefore: info.Size()}
+	var entries []speedtest.Result
+	err = scanLines(f, func(_, _ int64, line []byte) {
+		var e speedtest.Result
+		if json.Unmarshal(line, &e) != nil {
+			stats.Removed++ // unreadable lines go too
+			return
+		}
+		entries = append(entries, e)
+	})
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+
+	if r.MaxAge > 0 {
+		cutoff := now.Add(-r.MaxAge)
+		i := sort.Search(len(entries), func(i int) bool { return !entries[i].Timestamp.Before(cutoff) })
+		stats.Removed += i
+		entries = entries[i:]
+	}
+	if r.MaxEntries > 0 && len(entries) > r.MaxEntries {
+		stats.Removed += len(entries) - r.MaxEntries
+		entries = entries[len(entries)-r.MaxEntries:]
+	}
+	if r.CompactAfter > 0 {
+		cutoff := now.Add(-r.CompactAfter)
+		for i := range entries {
+			if entries[i].Timestamp.Before(cutoff) && Compact(&entries[i]) {
+				stats.Compacted++
+			}
+		}
+	}
+	stats.Kept = len(entries)
+
+	if stats.Removed == 0 && stats.Compacted == 0 {
+		stats.BytesAfter = stats.BytesBefore
+		return stats, nil
+	}
+
+	var buf []byte
+	for _, e := range entries {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, line...)
+		buf = append(buf, '\n')
+	}
+	if err := writeFileAtomic(s.path(), buf); err != nil {
+		return nil, err
+	}
+	if _, err := s.rebuildIndex(); err != nil {
+		return nil, err
+	}
+	stats.BytesAfter = int64(len(buf))
+	return stats, nil
+}
+
+// Compact drops the raw throughput and latency samples from r, keeping its
+// summary statistics. It reports whether there was anything to drop.
+func Compact(r *speedtest.Result) bool {
+	var had bool
+	for _, p := range []*speedtest.PhaseResult{r.Download, r.Upload, r.BidirDownload, r.BidirUpload} {
+		if p != nil {
+			had = had || len(p.Samples) > 0
+			p.Samples = nil
+		}
+	}
+	for _, l := range []*speedtest.LatencyResult{&r.IdleLatency, r.DownloadLatency, r.UploadLatency, r.BidirLatency} {
+		if l != nil {
+			had = had || len(l.Samples) > 0
+			l.Samples = nil
+		}
+	}
+	return had
+}
@@ -1,72 +1,210 @@
 package history
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
+	"time"
 
 	"github.com/allenan/brr/internal/speedtest"
 )
 
 // Store manages persisting speed test results.
+//
+// Results are appended to history.jsonl, one JSON document per line, so a
+// save costs the same however long the history is. A sidecar index of
+// timestamps and offsets (see index.go) serves time-range queries without
+// parsing every entry. Every access holds an advisory lock on history.lock,
+// so concurrent brr processes neither interleave writes nor race on the
+// index or the one-time migration.
 type Store struct {
-	path string
+	dir string
+
+	// Retention, if set, is applied by Save whenever the history exceeds
+	// its entry or age limit.
+	Retention Retention
 }
 
 // NewStore creates a store using the default config path.
 func NewStore() *Store {
+	return NewStoreAt(DefaultDir())
+}
+
+// DefaultDir returns the directory NewStore keeps history in: brr's
+// directory under the user's config directory.
+func DefaultDir() string {
 	configDir, err := os.UserConfigDir()
 	if err != nil {
 		configDir = filepath.Join(os.Getenv("HOME"), ".config")
 	}
-	return &Store{
-		path: filepath.Join(configDir, "brr", "history.json"),
-	}
+	return filepath.Join(configDir, "brr")
 }
 
+// NewStoreAt creates a store keeping its files in dir.
+func NewStoreAt(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+func (s *Store) path() string       { return filepath.Join(s.dir, "history.jsonl") }
+func (s *Store) indexPath() string  { return filepath.Join(s.dir, "history.idx") }
+func (s *Store) lockPath() string   { return filepath.Join(s.dir, "history.lock") }
+func (s *Store) legacyPath() string { return filepath.Join(s.dir, "history.json") }
+
 // Save appends a result to the history file.
 func (s *Store) Save(result *speedtest.Result) error {
-	entries, _ := s.Load() // ignore error on first run
-	entries = append(entries, *result)
+	line, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+	unlock, err := lockFile(s.lockPath())
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
-	// Ensure directory exists
-	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+	if err := s.migrate(); err != nil {
+		return err
+	}
+	// Bring the index in step before appending to it
+	idx, err := s.loadIndex()
+	if err != nil {
 		return err
 	}
 
-	// Atomic write via temp file
-	tmp := s.path + ".tmp"
-	data, err := json.MarshalIndent(entries, "", "  ")
+	f, err := os.OpenFile(s.path(), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
 	if err != nil {
+		f.Close()
+		return err
+	}
+	offset := info.Size()
+	if offset > 0 {
+		// Terminate a line left incomplete by a crash so ours starts fresh
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, offset-1); err == nil && last[0] != '\n' {
+			if _, err := f.Write([]byte{'\n'}); err != nil {
+				f.Close()
+				return err
+			}
+			offset++
+		}
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
 		return err
 	}
-	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+
+	rec := indexRecord{
+		Timestamp: result.Timestamp.UnixNano(),
+		Offset:    offset,
+		Length:    int64(len(line)),
+	}
+	if err := s.appendIndex(rec); err != nil {
 		return err
 	}
-	return os.Rename(tmp, s.path)
+
+	if now := time.Now(); overRetention(s.Retention, append(idx, rec), now) {
+		_, err = s.prune(s.Retention, now)
+	}
+	return err
 }
 
-// Load reads all history entries.
+// Load reads all history entries, most recent first.
 func (s *Store) Load() ([]speedtest.Result, error) {
-	data, err := os.ReadFile(s.path)
+	unlock, err := s.lockExisting()
+	if err != nil || unlock == nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if err := s.migrate(); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(s.path())
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, nil
 		}
 		return nil, err
 	}
+	defer f.Close()
 
 	var entries []speedtest.Result
-	if err := json.Unmarshal(data, &entries); err != nil {
+	err = scanLines(f, func(_, _ int64, line []byte) {
+		var r speedtest.Result
+		if json.Unmarshal(line, &r) == nil {
+			entries = append(entries, r)
+		}
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	// Sort by timestamp descending (most recent first)
-	sort.Slice(entries, func(i, j int) bool {
-		return entries[i].Timestamp.After(entries[j].Timestamp)
-	})
+	sortDescending(entries)
+	return entries, nil
+}
+
+// Range returns the entries with timestamps in [since, until), most recent
+// first. A zero since or until leaves that end of the range open. Only the
+// matching lines are read, using the index.
+func (s *Store) Range(since, until time.Time) ([]speedtest.Result, error) {
+	unlock, err := s.lockExisting()
+	if err != nil || unlock == nil {
+		return nil, err
+	}
+	defer unlock()
 
+	if err := s.migrate(); err != nil {
+		return nil, err
+	}
+	idx, err := s.loadIndex()
+	if err != nil {
+		return nil, err
+	}
+	if len(idx) == 0 {
+		return nil, nil
+	}
+
+	f, err := os.Open(s.path())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []speedtest.Result
+	for _, rec := range idx {
+		ts := time.Unix(0, rec.Timestamp)
+		if (!since.IsZero() && ts.Before(since)) || (!until.IsZero() && !ts.Before(until)) {
+			continue
+		}
+		line := make([]byte, rec.Length)
+		if _, err := f.ReadAt(line, rec.Offset); err != nil {
+			return nil, err
+		}
+		var r speedtest.Result
+		if json.Unmarshal(line, &r) == nil {
+			entries = append(entries, r)
+		}
+	}
+
+	sortDescending(entries)
 	return entries, nil
 }
 
@@ -82,9 +220,30 @@ func (s *Store) Last(n int) ([]speedtest.Result, error) {
 	return entries[:n], nil
 }
 
-// Average computes the average download/upload/latency over the last n entries.
+// LastOK returns the n most recent entries from completed runs, skipping
+// failed and cancelled ones.
+func (s *Store) LastOK(n int) ([]speedtest.Result, error) {
+	entries, err := s.Load()
+	if err != nil {
+		return nil, err
+	}
+	var ok []speedtest.Result
+	for _, e := range entries {
+		if len(ok) == n {
+			break
+		}
+		if e.Status.OK() {
+			ok = append(ok, e)
+		}
+	}
+	return ok, nil
+}
+
+// Average computes the average speeds, latencies, and bufferbloat grades over
+// the last n completed runs. Each phase is averaged over the runs that
+// measured it, and left nil if none did.
 func (s *Store) Average(n int) (*speedtest.Result, error) {
-	entries, err := s.Last(n)
+	entries, err := s.LastOK(n)
 	if err != nil {
 		return nil, err
 	}
@@ -93,17 +252,154 @@ func (s *Store) Average(n int) (*speedtest.Result, error) {
 	}
 
 	avg := &speedtest.Result{}
+	var dl, ul, idle, jitter, dlLatency, ulLatency, bidirDL, bidirUL, bidirLatency sum
+	var dlScore, ulScore, bidirScore gradeSum
 	for _, e := range entries {
-		avg.Download.Mbps += e.Download.Mbps
-		avg.Upload.Mbps += e.Upload.Mbps
-		avg.IdleLatency.Avg += e.IdleLatency.Avg
-		avg.IdleLatency.Jitter += e.IdleLatency.Jitter
+		if e.Download != nil {
+			dl.add(e.Download.Mbps)
+		}
+		if e.Upload != nil {
+			ul.add(e.Upload.Mbps)
+		}
+		idle.add(e.IdleLatency.Avg)
+		jitter.add(e.IdleLatency.Jitter)
+		if e.DownloadLatency != nil {
+			dlLatency.add(e.DownloadLatency.Avg)
+		}
+		if e.UploadLatency != nil {
+			ulLatency.add(e.UploadLatency.Avg)
+		}
+		if e.BidirDownload != nil && e.BidirUpload != nil && e.BidirLatency != nil {
+			bidirDL.add(e.BidirDownload.Mbps)
+			bidirUL.add(e.BidirUpload.Mbps)
+			bidirLatency.add(e.BidirLatency.Avg)
+		}
+		dlScore.add(e.BufferbloatDL)
+		ulScore.add(e.BufferbloatUL)
+		bidirScore.add(e.BufferbloatBidir)
+	}
+	if dl.count > 0 {
+		avg.Download = &speedtest.PhaseResult{Mbps: dl.average()}
+	}
+	if ul.count > 0 {
+		avg.Upload = &speedtest.PhaseResult{Mbps: ul.average()}
 	}
-	n64 := float64(len(entries))
-	avg.Download.Mbps /= n64
-	avg.Upload.Mbps /= n64
-	avg.IdleLatency.Avg /= n64
-	avg.IdleLatency.Jitter /= n64
+	avg.IdleLatency.Avg = idle.average()
+	avg.IdleLatency.Jitter = jitter.average()
+	if dlLatency.count > 0 {
+		avg.DownloadLatency = &speedtest.LatencyResult{Avg: dlLatency.average()}
+	}
+	if ulLatency.count > 0 {
+		avg.UploadLatency = &speedtest.LatencyResult{Avg: ulLatency.average()}
+	}
+	if bidirLatency.count > 0 {
+		avg.BidirDownload = &speedtest.PhaseResult{Mbps: bidirDL.average()}
+		avg.BidirUpload = &speedtest.PhaseResult{Mbps: bidirUL.average()}
+		avg.BidirLatency = &speedtest.LatencyResult{Avg: bidirLatency.average()}
+	}
+	avg.BufferbloatDL = dlScore.average()
+	avg.BufferbloatUL = ulScore.average()
+	avg.BufferbloatBidir = bidirScore.average()
 
 	return avg, nil
 }
+
+// sum accumulates values for an average.
+type sum struct {
+	total float64
+	count int
+}
+
+func (s *sum) add(v float64) {
+	s.total += v
+	s.count++
+}
+
+func (s sum) average() float64 {
+	if s.count == 0 {
+		return 0
+	}
+	return s.total / float64(s.count)
+}
+
+// gradeSum accumulates bufferbloat grade scores, ignoring unknown grades.
+type gradeSum struct {
+	total float64
+	count int
+}
+
+func (g *gradeSum) add(grade speedtest.BufferbloatGrade) {
+	if score := grade.Score(); score >= 0 {
+		g.total += float64(score)
+		g.count++
+	}
+}
+
+func (g gradeSum) average() speedtest.BufferbloatGrade {
+	if g.count == 0 {
+		return ""
+	}
+	return speedtest.GradeFromScore(g.total / float64(g.count))
+}
+
+// lockExisting takes the store lock for reading. It returns a nil unlock
+// function, and creates nothing, if the store directory doesn't exist yet.
+func (s *Store) lockExisting() (unlock func(), err error) {
+	if _, err := os.Stat(s.dir); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return lockFile(s.lockPath())
+}
+
+// writeFileAtomic replaces path with data via a uniquely named temp file in
+// the same directory.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, 0o644)
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// scanLines calls fn with the offset, length (including the newline) and
+// trimmed contents of each non-empty line in r. Lines may be arbitrarily
+// long. A final line without a newline, such as one cut short by a crash, is
+// skipped.
+func scanLines(r io.Reader, fn func(offset, length int64, line []byte)) error {
+	br := bufio.NewReader(r)
+	var offset int64
+	for {
+		line, err := br.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			fn(offset, int64(len(line)), trimmed)
+		}
+		offset += int64(len(line))
+	}
+}
+
+// sortDescending sorts entries by timestamp, most recent first.
+func sortDescending(entries []speedtest.Result) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp.After(entries[j].Timestamp)
+	})
+}
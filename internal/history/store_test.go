@@ -0,0 +1,339 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/allenan/brr/internal/speedtest"
+)
+
+func TestMigrateAndRange(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	// Legacy history.json: an unsorted array
+	legacy := []speedtest.Result{
+		{Timestamp: base.Add(2 * time.Hour), Download: &speedtest.PhaseResult{Mbps: 300}},
+		{Timestamp: base, Download: &speedtest.PhaseResult{Mbps: 100}},
+		{Timestamp: base.Add(time.Hour), Download: &speedtest.PhaseResult{Mbps: 200}},
+	}
+	data, _ := json.Marshal(legacy)
+	if err := os.WriteFile(filepath.Join(dir, "history.json"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewStoreAt(dir)
+	if err := s.Save(&speedtest.Result{Timestamp: base.Add(3 * time.Hour), Download: &speedtest.PhaseResult{Mbps: 400}}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "history.json.bak")); err != nil {
+		t.Errorf("legacy file not kept as backup: %v", err)
+	}
+
+	all, err := s.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(all) != 4 || all[0].Download.Mbps != 400 || all[3].Download.Mbps != 100 {
+		t.Fatalf("Load() = %v, want 4 entries newest first", mbps(all))
+	}
+
+	got, err := s.Range(base.Add(time.Hour), base.Add(3*time.Hour))
+	if err != nil {
+		t.Fatalf("Range() error = %v", err)
+	}
+	if len(got) != 2 || got[0].Download.Mbps != 300 || got[1].Download.Mbps != 200 {
+		t.Errorf("Range() = %v, want [300 200]", mbps(got))
+	}
+
+	// A lost index is rebuilt
+	os.Remove(filepath.Join(dir, "history.idx"))
+	got, err = s.Range(time.Time{}, base.Add(time.Hour))
+	if err != nil || len(got) != 1 || got[0].Download.Mbps != 100 {
+		t.Errorf("Range() after index loss = %v, %v; want [100]", mbps(got), err)
+	}
+}
+
+// Environment telling a re-executed test binary to act as one concurrent
+// writer: its id and the store directory.
+const (
+	writerEnv    = "BRR_HISTORY_TEST_WRITER"
+	writerDirEnv = "BRR_HISTORY_TEST_DIR"
+)
+
+const writers, perWriter = 4, 25
+
+func TestConcurrentWriters(t *testing.T) {
+	if id := os.Getenv(writerEnv); id != "" {
+		runWriter(t, os.Getenv(writerDirEnv), id)
+		return
+	}
+
+	dir := t.TempDir()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			cmd := exec.Command(os.Args[0], "-test.run=^TestConcurrentWriters$")
+			cmd.Env = append(os.Environ(), writerEnv+"="+strconv.Itoa(w), writerDirEnv+"="+dir)
+			if out, err := cmd.CombinedOutput(); err != nil {
+				errs <- fmt.Errorf("writer %d: %v\n%s", w, err, out)
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	s := NewStoreAt(dir)
+	all, err := s.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(all) != writers*perWriter {
+		t.Fatalf("Load() returned %d entries, want %d", len(all), writers*perWriter)
+	}
+	seen := make(map[string]bool)
+	for _, e := range all {
+		seen[e.ContextLine] = true
+	}
+	if len(seen) != writers*perWriter {
+		t.Errorf("%d distinct entries, want %d", len(seen), writers*perWriter)
+	}
+
+	// The index must cover every entry without a rebuild
+	ranged, err := s.Range(time.Time{}, time.Time{})
+	if err != nil || len(ranged) != writers*perWriter {
+		t.Errorf("Range() = %d entries, %v; want %d", len(ranged), err, writers*perWriter)
+	}
+}
+
+// runWriter saves perWriter entries from a child process.
+func runWriter(t *testing.T, dir, id string) {
+	s := NewStoreAt(dir)
+	for i := 0; i < perWriter; i++ {
+		r := &speedtest.Result{
+			Timestamp:   time.Now(),
+			ContextLine: fmt.Sprintf("writer %s entry %d", id, i),
+		}
+		if err := s.Save(r); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+}
+
+func mbps(entries []speedtest.Result) []float64 {
+	out := make([]float64, len(entries))
+	for i, e := range entries {
+		out[i] = e.Download.Mbps
+	}
+	return out
+}
+
+func TestPrune(t *testing.T) {
+	s := NewStoreAt(t.TempDir())
+	now := time.Now()
+	for _, age := range []time.Duration{100, 40, 20, 10, 5, 1} {
+		r := &speedtest.Result{
+			Timestamp:   now.Add(-age * 24 * time.Hour),
+			Download:    &speedtest.PhaseResult{Mbps: float64(age), Samples: []speedtest.Sample{{Mbps: 1}}},
+			IdleLatency: speedtest.LatencyResult{Avg: 10, Samples: []speedtest.LatencySample{{RTT: 10}}},
+		}
+		if err := s.Save(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := s.Prune(Retention{
+		MaxEntries:   4,
+		MaxAge:       60 * 24 * time.Hour,
+		CompactAfter: 15 * 24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	if stats.Removed != 2 || stats.Compacted != 1 || stats.Kept != 4 {
+		t.Errorf("Prune() = %+v, want 2 removed, 1 compacted, 4 kept", stats)
+	}
+	if stats.Reclaimed() <= 0 {
+		t.Errorf("Reclaimed() = %d, want > 0", stats.Reclaimed())
+	}
+
+	all, err := s.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := mbps(all); len(got) != 4 || got[3] != 20 {
+		t.Fatalf("entries after prune = %v, want [1 5 10 20]", got)
+	}
+	if oldest := all[3]; oldest.Download.Samples != nil || oldest.IdleLatency.Samples != nil || oldest.IdleLatency.Avg != 10 {
+		t.Errorf("oldest entry not compacted to its summary: %+v", oldest)
+	}
+	if len(all[0].Download.Samples) != 1 {
+		t.Errorf("recent entry lost its samples")
+	}
+
+	// Save applies the entry limit on its own
+	s.Retention = Retention{MaxEntries: 3}
+	if err := s.Save(&speedtest.Result{Timestamp: now}); err != nil {
+		t.Fatal(err)
+	}
+	if all, _ := s.Load(); len(all) != 3 {
+		t.Errorf("entries after Save with MaxEntries 3 = %d, want 3", len(all))
+	}
+}
+
+func TestQueryAndSummarize(t *testing.T) {
+	s := NewStoreAt(t.TempDir())
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local)
+	runs := []struct {
+		at    time.Duration
+		colo  string
+		mbps  float64
+		grade speedtest.BufferbloatGrade
+	}{
+		{9 * time.Hour, "SEA", 100, speedtest.GradeA},
+		{19 * time.Hour, "SEA", 40, speedtest.GradeC},
+		{24*time.Hour + 9*time.Hour, "SEA", 120, speedtest.GradeA},
+		{24*time.Hour + 19*time.Hour, "PDX", 30, speedtest.GradeD},
+		{24*time.Hour + 19*time.Hour + time.Minute, "", 0, ""},
+	}
+	for _, r := range runs {
+		res := &speedtest.Result{
+			Timestamp:     day.Add(r.at),
+			Server:        speedtest.ServerInfo{Colo: r.colo},
+			Download:      &speedtest.PhaseResult{Mbps: r.mbps},
+			BufferbloatDL: r.grade,
+		}
+		if r.colo == "" {
+			res.Status = speedtest.StatusError
+		}
+		if err := s.Save(res); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := s.Query(Query{Colos: []string{"sea"}, Grades: []speedtest.BufferbloatGrade{"A"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := mbps(got); len(m) != 2 || m[0] != 120 || m[1] != 100 {
+		t.Errorf("Query(colo sea, grade A) = %v, want [120 100]", m)
+	}
+	if got, _ := s.Query(Query{Since: day.Add(24 * time.Hour), Limit: 1}); len(got) != 1 || got[0].Status != speedtest.StatusError {
+		t.Errorf("Query(since day 2, limit 1) = %+v, want the failed run", got)
+	}
+
+	all, _ := s.Query(Query{})
+	byHour := Summarize(all, GroupHour)
+	if len(byHour) != 2 || byHour[0].Group != "09:00" || byHour[1].Group != "19:00" {
+		t.Fatalf("Summarize(hour) groups = %+v", byHour)
+	}
+	evening := byHour[1]
+	if evening.Runs != 3 || evening.Failed != 1 {
+		t.Errorf("evening runs = %d (%d failed), want 3 (1 failed)", evening.Runs, evening.Failed)
+	}
+	if dl := evening.Metrics[0]; dl.Metric != "download" || dl.Min != 30 || dl.Median != 35 || dl.Max != 40 {
+		t.Errorf("evening download = %+v, want min 30, median 35, max 40", dl)
+	}
+}
+
+func TestAverage(t *testing.T) {
+	s := NewStoreAt(t.TempDir())
+	base := time.Now()
+	for i, r := range []*speedtest.Result{
+		{
+			Download:        &speedtest.PhaseResult{Mbps: 100},
+			Upload:          &speedtest.PhaseResult{Mbps: 10},
+			IdleLatency:     speedtest.LatencyResult{Avg: 10, Jitter: 1},
+			DownloadLatency: &speedtest.LatencyResult{Avg: 40},
+			UploadLatency:   &speedtest.LatencyResult{Avg: 80},
+			BufferbloatDL:   speedtest.GradeAPlus,
+			BufferbloatUL:   speedtest.GradeB,
+		},
+		speedtest.FailedResult(fmt.Errorf("boom")),
+		{
+			Download:         &speedtest.PhaseResult{Mbps: 300},
+			Upload:           &speedtest.PhaseResult{Mbps: 30},
+			IdleLatency:      speedtest.LatencyResult{Avg: 20, Jitter: 3},
+			DownloadLatency:  &speedtest.LatencyResult{Avg: 60},
+			UploadLatency:    &speedtest.LatencyResult{Avg: 100},
+			BufferbloatDL:    speedtest.GradeB,
+			BufferbloatUL:    speedtest.GradeF,
+			BidirDownload:    &speedtest.PhaseResult{Mbps: 50},
+			BidirUpload:      &speedtest.PhaseResult{Mbps: 5},
+			BidirLatency:     &speedtest.LatencyResult{Avg: 200},
+			BufferbloatBidir: speedtest.GradeD,
+		},
+	} {
+		r.Timestamp = base.Add(time.Duration(i) * time.Minute)
+		if err := s.Save(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	avg, err := s.Average(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if avg.Download.Mbps != 200 || avg.Upload.Mbps != 20 {
+		t.Errorf("average speeds %v/%v, want 200/20 (failed run excluded)", avg.Download.Mbps, avg.Upload.Mbps)
+	}
+	if avg.IdleLatency.Avg != 15 || avg.IdleLatency.Jitter != 2 || avg.DownloadLatency.Avg != 50 || avg.UploadLatency.Avg != 90 {
+		t.Errorf("average latencies = %+v %+v %+v", avg.IdleLatency, avg.DownloadLatency, avg.UploadLatency)
+	}
+	// A+ (5) and B (3) average to A; B (3) and F (0) round to C
+	if avg.BufferbloatDL != speedtest.GradeA || avg.BufferbloatUL != speedtest.GradeC {
+		t.Errorf("average grades %q/%q, want A/C", avg.BufferbloatDL, avg.BufferbloatUL)
+	}
+	if avg.BidirDownload == nil || avg.BidirDownload.Mbps != 50 || avg.BidirLatency.Avg != 200 || avg.BufferbloatBidir != speedtest.GradeD {
+		t.Errorf("average bidir %+v %+v %q, want the one run that measured it", avg.BidirDownload, avg.BidirLatency, avg.BufferbloatBidir)
+	}
+
+	if avg, err := NewStoreAt(t.TempDir()).Average(5); err != nil || avg != nil {
+		t.Errorf("Average of empty history = %+v, %v; want nil", avg, err)
+	}
+}
+
+func TestAverageSkippedPhases(t *testing.T) {
+	s := NewStoreAt(t.TempDir())
+	base := time.Now()
+	for i, r := range []*speedtest.Result{
+		{Download: &speedtest.PhaseResult{Mbps: 100}, Upload: &speedtest.PhaseResult{Mbps: 10}, BufferbloatDL: speedtest.GradeA},
+		{Download: &speedtest.PhaseResult{Mbps: 200}, BufferbloatDL: speedtest.GradeC},
+		{IdleLatency: speedtest.LatencyResult{Avg: 30}},
+	} {
+		r.Timestamp = base.Add(time.Duration(i) * time.Minute)
+		if err := s.Save(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	avg, err := s.Average(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if avg.Download == nil || avg.Download.Mbps != 150 || avg.Upload == nil || avg.Upload.Mbps != 10 {
+		t.Errorf("average download %+v, upload %+v; want 150 and 10 over the runs that measured them", avg.Download, avg.Upload)
+	}
+	if avg.IdleLatency.Avg != 10 || avg.BufferbloatDL != speedtest.GradeB || avg.UploadLatency != nil {
+		t.Errorf("average = %+v", avg)
+	}
+
+	stats := Summarize([]speedtest.Result{{IdleLatency: speedtest.LatencyResult{Avg: 30}}}, GroupNone)
+	if m := stats[0].Metrics; len(m) != 2 || m[0].Metric != "idle_latency" {
+		t.Errorf("Summarize of a latency-only run = %+v, want idle latency and jitter only", m)
+	}
+}
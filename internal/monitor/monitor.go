@@ -0,0 +1,149 @@
+// Package monitor runs speed tests on a schedule.
+package monitor
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// Default backoff after failed runs.
+const (
+	DefaultBackoff    = time.Minute
+	DefaultMaxBackoff = time.Hour
+)
+
+// Monitor calls Run on a schedule until its context is cancelled.
+//
+// A run that is still going when the next one is due makes the monitor skip
+// that slot rather than overlap. After a failure the next run waits at least
+// Backoff, doubling with each consecutive failure up to MaxBackoff.
+type Monitor struct {
+	Schedule   Schedule
+	Jitter     time.Duration // random delay in [0, Jitter) added to each run
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	Immediate  bool // run once at start instead of waiting for the first slot
+
+	// Run performs one test. It receives the monitor's context and should
+	// return promptly once it is cancelled.
+	Run func(ctx context.Context) error
+
+	// Logf, if set, receives a line for skipped runs, failures and backoff.
+	Logf func(format string, args ...any)
+}
+
+// New returns a monitor with default backoff.
+func New(schedule Schedule, run func(ctx context.Context) error) *Monitor {
+	return &Monitor{
+		Schedule:   schedule,
+		Backoff:    DefaultBackoff,
+		MaxBackoff: DefaultMaxBackoff,
+		Run:        run,
+	}
+}
+
+// Start runs the schedule until ctx is cancelled. On cancellation it waits
+// for an in-flight run to return and then returns nil.
+func (m *Monitor) Start(ctx context.Context) error {
+	now := time.Now()
+	next := now
+	if !m.Immediate {
+		next = m.nextRun(now)
+		if next.IsZero() {
+			return errors.New("schedule has no upcoming runs")
+		}
+	}
+	m.logf("next run at %s", next.Format(time.DateTime))
+
+	timer := time.NewTimer(time.Until(next))
+	defer timer.Stop()
+
+	done := make(chan error, 1)
+	running := false
+	failures := 0
+
+	for {
+		select {
+		case <-ctx.Done():
+			if running {
+				<-done
+			}
+			return nil
+
+		case err := <-done:
+			running = false
+			if err == nil || ctx.Err() != nil {
+				failures = 0
+				continue
+			}
+			failures++
+			delay := backoff(m.Backoff, m.MaxBackoff, failures)
+			m.logf("run failed (%d in a row): %v", failures, err)
+			if earliest := time.Now().Add(delay); next.Before(earliest) {
+				next = earliest
+				m.logf("backing off; next run at %s", next.Format(time.DateTime))
+				resetTimer(timer, time.Until(next))
+			}
+
+		case <-timer.C:
+			if running {
+				m.logf("previous run still going; skipping this one")
+			} else {
+				running = true
+				go func() { done <- m.Run(ctx) }()
+			}
+			next = m.nextRun(time.Now())
+			if next.IsZero() {
+				if running {
+					<-done
+				}
+				return nil
+			}
+			timer.Reset(time.Until(next))
+		}
+	}
+}
+
+// nextRun returns the next scheduled time after t with jitter applied.
+func (m *Monitor) nextRun(t time.Time) time.Time {
+	next := m.Schedule.Next(t)
+	if next.IsZero() || m.Jitter <= 0 {
+		return next
+	}
+	return next.Add(time.Duration(rand.Int63n(int64(m.Jitter))))
+}
+
+func (m *Monitor) logf(format string, args ...any) {
+	if m.Logf != nil {
+		m.Logf(format, args...)
+	}
+}
+
+// backoff returns the minimum delay after n consecutive failures: base,
+// doubling per failure, capped at max.
+func backoff(base, max time.Duration, n int) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	d := base
+	for i := 1; i < n && d < max; i++ {
+		d *= 2
+	}
+	if max > 0 && d > max {
+		d = max
+	}
+	return d
+}
+
+// resetTimer stops t, drains it if it already fired, and resets it to d.
+func resetTimer(t *time.Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+	t.Reset(d)
+}
@@ -0,0 +1,200 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// never is a schedule with no upcoming runs.
+type never struct{}
+
+func (never) Next(time.Time) time.Time { return time.Time{} }
+
+// logRecorder collects a monitor's log lines.
+type logRecorder struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *logRecorder) Logf(format string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+}
+
+func (l *logRecorder) contains(s string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, line := range l.lines {
+		if strings.Contains(line, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// start runs m in the background and returns a function that cancels it and
+// returns Start's error.
+func start(t *testing.T, m *Monitor) (stop func() error) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- m.Start(ctx) }()
+	return func() error {
+		cancel()
+		select {
+		case err := <-errc:
+			return err
+		case <-time.After(2 * time.Second):
+			t.Fatal("Start did not return after cancel")
+			return nil
+		}
+	}
+}
+
+func TestMonitorImmediate(t *testing.T) {
+	ran := make(chan struct{}, 1)
+	run := func(context.Context) error {
+		select {
+		case ran <- struct{}{}:
+		default:
+		}
+		return nil
+	}
+
+	m := New(Every(time.Hour), run)
+	m.Immediate = true
+	stop := start(t, m)
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Error("immediate monitor didn't run at start")
+	}
+	if err := stop(); err != nil {
+		t.Errorf("Start() = %v, want nil on cancel", err)
+	}
+
+	stop = start(t, New(Every(time.Hour), run))
+	select {
+	case <-ran:
+		t.Error("monitor ran before its first slot")
+	case <-time.After(50 * time.Millisecond):
+	}
+	stop()
+}
+
+func TestMonitorSkipsSlotsWhileRunning(t *testing.T) {
+	var calls, inFlight, overlapped atomic.Int32
+	run := func(context.Context) error {
+		if inFlight.Add(1) > 1 {
+			overlapped.Store(1)
+		}
+		defer inFlight.Add(-1)
+		if calls.Add(1) == 1 {
+			time.Sleep(80 * time.Millisecond) // spans several 10ms slots
+		}
+		return nil
+	}
+
+	log := &logRecorder{}
+	m := New(Every(10*time.Millisecond), run)
+	m.Immediate = true
+	m.Logf = log.Logf
+	stop := start(t, m)
+	time.Sleep(150 * time.Millisecond)
+	stop()
+
+	if overlapped.Load() != 0 {
+		t.Error("runs overlapped")
+	}
+	if !log.contains("skipping") {
+		t.Errorf("no skipped slot logged: %q", log.lines)
+	}
+	// 150ms at 10ms would be 15 runs; the slow first run swallowed ~8 slots
+	if n := calls.Load(); n < 2 || n > 10 {
+		t.Errorf("%d runs, want a few after the slow one", n)
+	}
+}
+
+func TestMonitorBacksOffAfterFailures(t *testing.T) {
+	var mu sync.Mutex
+	var starts []time.Time
+	run := func(context.Context) error {
+		mu.Lock()
+		starts = append(starts, time.Now())
+		mu.Unlock()
+		return errors.New("no network")
+	}
+
+	log := &logRecorder{}
+	m := New(Every(5*time.Millisecond), run)
+	m.Immediate = true
+	m.Backoff = 60 * time.Millisecond
+	m.MaxBackoff = time.Second
+	m.Logf = log.Logf
+	stop := start(t, m)
+	time.Sleep(250 * time.Millisecond)
+	stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	// Backoff of 60ms then 120ms leaves room for 3 runs, where the 5ms
+	// schedule alone would allow dozens
+	if len(starts) < 2 || len(starts) > 4 {
+		t.Fatalf("%d runs in 250ms, want 2-4 with backoff", len(starts))
+	}
+	if gap := starts[1].Sub(starts[0]); gap < 60*time.Millisecond {
+		t.Errorf("second run %v after the first failure, want at least the 60ms backoff", gap)
+	}
+	if len(starts) > 2 {
+		if gap := starts[2].Sub(starts[1]); gap < 120*time.Millisecond {
+			t.Errorf("third run %v after the second failure, want the backoff doubled to 120ms", gap)
+		}
+	}
+	if !log.contains("2 in a row") || !log.contains("backing off") {
+		t.Errorf("failures not logged: %q", log.lines)
+	}
+}
+
+func TestMonitorCancelWaitsForRun(t *testing.T) {
+	started := make(chan struct{})
+	var finished atomic.Bool
+	m := New(Every(time.Hour), func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		time.Sleep(20 * time.Millisecond) // e.g. saving the failed result
+		finished.Store(true)
+		return ctx.Err()
+	})
+	m.Immediate = true
+	stop := start(t, m)
+	<-started
+	if err := stop(); err != nil {
+		t.Errorf("Start() = %v, want nil", err)
+	}
+	if !finished.Load() {
+		t.Error("Start returned before the in-flight run")
+	}
+}
+
+func TestMonitorScheduleWithoutRuns(t *testing.T) {
+	var calls atomic.Int32
+	run := func(context.Context) error { calls.Add(1); return nil }
+
+	if err := New(never{}, run).Start(context.Background()); err == nil {
+		t.Error("Start() with no upcoming runs succeeded")
+	}
+
+	// With --now there is one run, then the schedule ends
+	m := New(never{}, run)
+	m.Immediate = true
+	if err := m.Start(context.Background()); err != nil || calls.Load() != 1 {
+		t.Errorf("Start() = %v after %d runs, want nil after 1", err, calls.Load())
+	}
+}
@@ -0,0 +1,219 @@
+// Package notify reports finished runs to webhooks and local commands.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/allenan/brr/internal/assert"
+	"github.com/allenan/brr/internal/speedtest"
+)
+
+// DefaultTimeout bounds each webhook request and command.
+const DefaultTimeout = 30 * time.Second
+
+// Notifier fires hooks for finished runs.
+type Notifier struct {
+	// WebhookURL, if set, receives a POST for each notification: the result
+	// as JSON, or Template rendered with an Event.
+	WebhookURL string
+	Template   *template.Template
+
+	// Command, if set, runs through the shell with the result JSON on stdin
+	// and the BRR_* variables described at Env.
+	Command string
+
+	// Conditions limit notifications to completed runs for which at least
+	// one condition holds, e.g. "download<100" or "bloat<B". Runs that
+	// failed always notify; cancelled runs never do. With no conditions
+	// every run notifies.
+	Conditions []assert.Assertion
+
+	Client  *http.Client
+	Timeout time.Duration
+}
+
+// Event is the data a webhook template is executed with.
+type Event struct {
+	Result    *speedtest.Result
+	Triggered []string // the conditions that held
+	Summary   string   // one-line summary, as printed by --simple
+}
+
+// ParseTemplate parses a webhook payload template. Besides the standard
+// functions it provides json, which encodes a value as JSON, for embedding
+// strings safely in JSON payloads.
+func ParseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(text)
+}
+
+// Triggered returns the conditions that hold for result, and whether it
+// should be notified at all.
+func (n *Notifier) Triggered(result *speedtest.Result) ([]string, bool) {
+	switch {
+	case result.Status == speedtest.StatusCancelled:
+		return nil, false
+	case !result.Status.OK(), len(n.Conditions) == 0:
+		return nil, true
+	}
+	var held []string
+	for _, o := range assert.Evaluate(n.Conditions, result) {
+		if o.Passed {
+			held = append(held, o.Assertion.Expr)
+		}
+	}
+	return held, len(held) > 0
+}
+
+// Notify fires the configured hooks if result meets the conditions. Both
+// hooks are attempted; their errors are joined.
+func (n *Notifier) Notify(ctx context.Context, result *speedtest.Result) error {
+	triggered, ok := n.Triggered(result)
+	if !ok {
+		return nil
+	}
+	ev := &Event{Result: result, Triggered: triggered, Summary: Summary(result)}
+
+	var errs []error
+	if n.WebhookURL != "" {
+		if err := n.postWebhook(ctx, ev); err != nil {
+			errs = append(errs, fmt.Errorf("webhook: %w", err))
+		}
+	}
+	if n.Command != "" {
+		if err := n.runCommand(ctx, ev); err != nil {
+			errs = append(errs, fmt.Errorf("command: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (n *Notifier) timeout() time.Duration {
+	if n.Timeout > 0 {
+		return n.Timeout
+	}
+	return DefaultTimeout
+}
+
+func (n *Notifier) postWebhook(ctx context.Context, ev *Event) error {
+	var body bytes.Buffer
+	if n.Template != nil {
+		if err := n.Template.Execute(&body, ev); err != nil {
+			return err
+		}
+	} else if err := json.NewEncoder(&body).Encode(ev.Result); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, n.timeout())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.WebhookURL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := n.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s returned %s", n.WebhookURL, resp.Status)
+	}
+	return nil
+}
+
+func (n *Notifier) runCommand(ctx context.Context, ev *Event) error {
+	stdin, err := json.Marshal(ev.Result)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, n.timeout())
+	defer cancel()
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", n.Command)
+	} else {
+		cmd = exec.CommandContext(ctx, "/bin/sh", "-c", n.Command)
+	}
+	cmd.Stdin = bytes.NewReader(append(stdin, '\n'))
+	cmd.Stdout = os.Stderr // keep brr's own stdout machine-readable
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), Env(ev)...)
+	return cmd.Run()
+}
+
+// Env returns the environment variables passed to --on-complete commands:
+//
+//	BRR_STATUS          ok, error, preflight_failed or cancelled
+//	BRR_ERROR           the error, for failed runs
+//	BRR_TIMESTAMP       RFC 3339 time of the run
+//	BRR_DOWNLOAD_MBPS   BRR_UPLOAD_MBPS (empty if the phase was skipped)
+//	BRR_LATENCY_MS      BRR_JITTER_MS (idle)
+//	BRR_BUFFERBLOAT_DL  BRR_BUFFERBLOAT_UL  BRR_BUFFERBLOAT_BIDIR (with --bidir)
+//	BRR_COLO            BRR_LOCATION  BRR_IP
+//	BRR_TRIGGERED       comma-separated conditions that held
+//	BRR_SUMMARY         one-line summary
+func Env(ev *Event) []string {
+	r := ev.Result
+	status := r.Status
+	if status == "" {
+		status = speedtest.StatusOK
+	}
+	mbps := func(v float64) string { return strconv.FormatFloat(v, 'f', 1, 64) }
+	phaseMbps := func(p *speedtest.PhaseResult) string {
+		if p == nil {
+			return ""
+		}
+		return mbps(p.Mbps)
+	}
+	return []string{
+		"BRR_STATUS=" + string(status),
+		"BRR_ERROR=" + r.Error,
+		"BRR_TIMESTAMP=" + r.Timestamp.Format(time.RFC3339),
+		"BRR_DOWNLOAD_MBPS=" + phaseMbps(r.Download),
+		"BRR_UPLOAD_MBPS=" + phaseMbps(r.Upload),
+		"BRR_LATENCY_MS=" + mbps(r.IdleLatency.Avg),
+		"BRR_JITTER_MS=" + mbps(r.IdleLatency.Jitter),
+		"BRR_BUFFERBLOAT_DL=" + string(r.BufferbloatDL),
+		"BRR_BUFFERBLOAT_UL=" + string(r.BufferbloatUL),
+		"BRR_BUFFERBLOAT_BIDIR=" + string(r.BufferbloatBidir),
+		"BRR_COLO=" + r.Server.Colo,
+		"BRR_LOCATION=" + r.Server.Location,
+		"BRR_IP=" + r.Server.IP,
+		"BRR_TRIGGERED=" + strings.Join(ev.Triggered, ","),
+		"BRR_SUMMARY=" + ev.Summary,
+	}
+}
+
+// Summary returns a one-line description of result.
+func Summary(r *speedtest.Result) string {
+	if !r.Status.OK() {
+		return fmt.Sprintf("brr run %s: %s", strings.ReplaceAll(string(r.Status), "_", " "), r.Error)
+	}
+	return speedtest.Headline(r) + "  " + r.Server.Colo
+}
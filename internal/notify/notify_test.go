@@ -0,0 +1,85 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/allenan/brr/internal/assert"
+	"github.com/allenan/brr/internal/speedtest"
+)
+
+func TestNotify(t *testing.T) {
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+	}))
+	defer srv.Close()
+
+	conds, err := assert.Parse("download<100,bloat<B")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := ParseTemplate("slack", `{"text": {{json .Summary}}, "why": {{json .Triggered}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := &Notifier{WebhookURL: srv.URL, Template: tmpl, Conditions: conds}
+
+	fast := &speedtest.Result{Status: speedtest.StatusOK, Download: &speedtest.PhaseResult{Mbps: 300}, BufferbloatDL: speedtest.GradeA}
+	slow := &speedtest.Result{Status: speedtest.StatusOK, Download: &speedtest.PhaseResult{Mbps: 50}, BufferbloatDL: speedtest.GradeA}
+	failed := speedtest.FailedResult(io.ErrUnexpectedEOF)
+	cancelled := speedtest.FailedResult(context.Canceled)
+
+	for _, r := range []*speedtest.Result{fast, slow, failed, cancelled} {
+		if err := n.Notify(context.Background(), r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(bodies) != 2 {
+		t.Fatalf("got %d webhooks, want 2 (slow and failed): %q", len(bodies), bodies)
+	}
+	var payload struct {
+		Text string   `json:"text"`
+		Why  []string `json:"why"`
+	}
+	if err := json.Unmarshal([]byte(bodies[0]), &payload); err != nil {
+		t.Fatalf("template output isn't JSON: %v\n%s", err, bodies[0])
+	}
+	if !strings.Contains(payload.Text, "50.0 Mbps") || len(payload.Why) != 1 || payload.Why[0] != "download<100" {
+		t.Errorf("unexpected payload %+v", payload)
+	}
+	if !strings.Contains(bodies[1], "unexpected EOF") {
+		t.Errorf("failed run payload missing error: %s", bodies[1])
+	}
+}
+
+func TestCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses /bin/sh")
+	}
+	out := filepath.Join(t.TempDir(), "out")
+	n := &Notifier{Command: `cat > "$OUT"; echo "$BRR_STATUS $BRR_DOWNLOAD_MBPS" >> "$OUT"`}
+	t.Setenv("OUT", out)
+
+	r := &speedtest.Result{Status: speedtest.StatusOK, Download: &speedtest.PhaseResult{Mbps: 123.45}}
+	if err := n.Notify(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"mbps":123.45`) || lines[1] != "ok 123.5" {
+		t.Errorf("unexpected command output:\n%s", b)
+	}
+}
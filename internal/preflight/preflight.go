@@ -1,12 +1,10 @@
 package preflight
 
 import (
-	"bufio"
 	"context"
 	"fmt"
 	"net"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/allenan/brr/internal/speedtest"
@@ -38,11 +36,35 @@ type Result struct {
 	Message string // diagnostic if failed
 }
 
+// FailedResult returns the history entry for a run stopped by these checks.
+func (r *Result) FailedResult() *speedtest.Result {
+	outcomes := make([]speedtest.CheckOutcome, len(r.Checks))
+	for i, c := range r.Checks {
+		outcomes[i] = speedtest.CheckOutcome{
+			Name:    string(c.Name),
+			Passed:  c.Passed,
+			Detail:  c.Detail,
+			Latency: c.Latency,
+		}
+		if c.Err != nil {
+			outcomes[i].Error = c.Err.Error()
+		}
+	}
+	return &speedtest.Result{
+		Timestamp: time.Now(),
+		Status:    speedtest.StatusPreflightFailed,
+		Error:     r.Message,
+		Preflight: outcomes,
+	}
+}
+
 // OnCheck is called after each individual check completes.
 type OnCheck func(CheckResult)
 
-// Run executes all 4 preflight checks sequentially, calling onCheck after each.
-func Run(ctx context.Context, client *http.Client, onCheck OnCheck) *Result {
+// Run executes all 4 preflight checks sequentially against backend, calling
+// onCheck after each. The internet and DNS checks use only family, unless it
+// is FamilyAny; client should be restricted to it too.
+func Run(ctx context.Context, client *http.Client, backend speedtest.Backend, family speedtest.AddressFamily, onCheck OnCheck) *Result {
 	var checks []CheckResult
 
 	// 1. Gateway
@@ -51,17 +73,17 @@ func Run(ctx context.Context, client *http.Client, onCheck OnCheck) *Result {
 	onCheck(gwResult)
 
 	// 2. Internet
-	inetResult := checkInternet(ctx)
+	inetResult := checkInternet(ctx, family)
 	checks = append(checks, inetResult)
 	onCheck(inetResult)
 
 	// 3. DNS
-	dnsResult := checkDNS(ctx)
+	dnsResult := checkDNS(ctx, backend.Host(), family)
 	checks = append(checks, dnsResult)
 	onCheck(dnsResult)
 
 	// 4. Test server
-	serverResult := checkTestServer(ctx, client)
+	serverResult := checkTestServer(ctx, client, backend)
 	checks = append(checks, serverResult)
 	onCheck(serverResult)
 
@@ -72,7 +94,7 @@ func Run(ctx context.Context, client *http.Client, onCheck OnCheck) *Result {
 		return result
 	}
 
-	result.Message = diagnose(checks)
+	result.Message = diagnose(checks, backend.Host(), family)
 	return result
 }
 
@@ -107,16 +129,21 @@ func checkGateway(ctx context.Context) CheckResult {
 	}
 }
 
-func checkInternet(ctx context.Context) CheckResult {
+func checkInternet(ctx context.Context, family speedtest.AddressFamily) CheckResult {
+	host := "1.1.1.1"
+	if family == speedtest.FamilyIPv6 {
+		host = "2606:4700:4700::1111"
+	}
+
 	start := time.Now()
 	dialer := &net.Dialer{Timeout: 3 * time.Second}
-	conn, err := dialer.DialContext(ctx, "tcp", "1.1.1.1:443")
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, "443"))
 	latency := time.Since(start).Seconds() * 1000
 
 	if err != nil {
 		return CheckResult{
 			Name:   CheckInternet,
-			Detail: "1.1.1.1",
+			Detail: host,
 			Err:    err,
 		}
 	}
@@ -125,17 +152,17 @@ func checkInternet(ctx context.Context) CheckResult {
 	return CheckResult{
 		Name:    CheckInternet,
 		Passed:  true,
-		Detail:  "1.1.1.1",
+		Detail:  host,
 		Latency: latency,
 	}
 }
 
-func checkDNS(ctx context.Context) CheckResult {
+func checkDNS(ctx context.Context, host string, family speedtest.AddressFamily) CheckResult {
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	start := time.Now()
-	addrs, err := net.DefaultResolver.LookupHost(ctx, "speed.cloudflare.com")
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, family.Network("ip"), host)
 	latency := time.Since(start).Seconds() * 1000
 
 	if err != nil || len(addrs) == 0 {
@@ -148,60 +175,35 @@ func checkDNS(ctx context.Context) CheckResult {
 	return CheckResult{
 		Name:    CheckDNS,
 		Passed:  true,
-		Detail:  addrs[0],
+		Detail:  addrs[0].String(),
 		Latency: latency,
 	}
 }
 
-func checkTestServer(ctx context.Context, client *http.Client) CheckResult {
+func checkTestServer(ctx context.Context, client *http.Client, backend speedtest.Backend) CheckResult {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
 	start := time.Now()
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://speed.cloudflare.com/cdn-cgi/trace", nil)
-	if err != nil {
-		return CheckResult{
-			Name: CheckTestServer,
-			Err:  err,
-		}
-	}
+	info, err := backend.FetchMeta(ctx, client)
+	latency := time.Since(start).Seconds() * 1000
 
-	resp, err := client.Do(req)
 	if err != nil {
 		return CheckResult{
 			Name: CheckTestServer,
 			Err:  err,
 		}
 	}
-	defer resp.Body.Close()
-	latency := time.Since(start).Seconds() * 1000
-
-	// Parse colo from response
-	var colo string
-	scanner := bufio.NewScanner(resp.Body)
-	for scanner.Scan() {
-		line := scanner.Text()
-		parts := strings.SplitN(line, "=", 2)
-		if len(parts) == 2 && parts[0] == "colo" {
-			colo = parts[1]
-			break
-		}
-	}
-
-	detail := colo
-	if city := speedtest.ColoName(colo); city != colo {
-		detail = city
-	}
 
 	return CheckResult{
 		Name:    CheckTestServer,
 		Passed:  true,
-		Detail:  detail,
+		Detail:  info.ColoCity,
 		Latency: latency,
 	}
 }
 
-func diagnose(checks []CheckResult) string {
+func diagnose(checks []CheckResult, host string, family speedtest.AddressFamily) string {
 	gw := checks[0]
 	inet := checks[1]
 	dns := checks[2]
@@ -214,13 +216,21 @@ func diagnose(checks []CheckResult) string {
 		return fmt.Sprintf("Can't reach your router (%s) — check your WiFi or ethernet connection", gw.Detail)
 	}
 
+	if !inet.Passed && family == speedtest.FamilyIPv6 {
+		return "Your router is reachable but IPv6 internet is not. Your ISP or router may not provide IPv6."
+	}
+
 	if !inet.Passed {
 		return "Your router is reachable but the internet connection appears down. This is likely an ISP issue."
 	}
 
+	if !dns.Passed && family != speedtest.FamilyAny {
+		return fmt.Sprintf("%s has no %s address, or DNS resolution failed", host, family)
+	}
+
 	if !dns.Passed {
 		return "DNS resolution failed — try using 1.1.1.1 or 8.8.8.8 as your DNS server"
 	}
 
-	return "Can't reach speed.cloudflare.com — check firewall settings or try again later"
+	return fmt.Sprintf("Can't reach %s — check firewall settings or try again later", host)
 }
@@ -0,0 +1,42 @@
+package preflight
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/allenan/brr/internal/speedtest"
+)
+
+func TestFailedResult(t *testing.T) {
+	r := &Result{
+		Checks: []CheckResult{
+			{Name: CheckGateway, Passed: true, Detail: "192.168.1.1", Latency: 2},
+			{Name: CheckInternet, Detail: "1.1.1.1", Err: errors.New("i/o timeout")},
+			{Name: CheckDNS, Err: errors.New("no such host")},
+			{Name: CheckTestServer, Err: errors.New("no such host")},
+		},
+		Message: "Your router is reachable but the internet is not",
+	}
+
+	got := r.FailedResult()
+	if got.Status != speedtest.StatusPreflightFailed || got.Error != r.Message {
+		t.Errorf("status %q error %q, want %q with the diagnosis", got.Status, got.Error, speedtest.StatusPreflightFailed)
+	}
+	if got.Timestamp.IsZero() || got.Download != nil {
+		t.Errorf("result = %+v, want a timestamped result without phases", got)
+	}
+	want := []speedtest.CheckOutcome{
+		{Name: "gateway", Passed: true, Detail: "192.168.1.1", Latency: 2},
+		{Name: "internet", Detail: "1.1.1.1", Error: "i/o timeout"},
+		{Name: "dns", Error: "no such host"},
+		{Name: "server", Error: "no such host"},
+	}
+	if len(got.Preflight) != len(want) {
+		t.Fatalf("preflight = %+v, want %d checks", got.Preflight, len(want))
+	}
+	for i := range want {
+		if got.Preflight[i] != want[i] {
+			t.Errorf("check %d = %+v, want %+v", i, got.Preflight[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package server
+
+import (
+	"errors"
+	"net"
+
+	"github.com/allenan/brr/internal/speedtest"
+)
+
+// ServeEcho echoes brr's packet loss probes received on conn back to their
+// sender. Other datagrams are dropped, so the server can't be used as a
+// general-purpose reflector. It returns nil once conn is closed.
+func ServeEcho(conn net.PacketConn) error {
+	buf := make([]byte, 2048)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		if speedtest.IsLossProbe(buf[:n]) {
+			conn.WriteTo(buf[:n], addr)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Package server implements a self-hosted speed test server that speaks the
+// same protocol as Cloudflare's speed test, so brr can measure links between
+// hosts under our control.
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultMaxBytes caps the size of a single /__down response.
+const DefaultMaxBytes = 1_000_000_000
+
+// Options configures the test server.
+type Options struct {
+	Colo     string // reported as colo= by the trace endpoint
+	Location string // reported as loc= by the trace endpoint
+	MaxBytes int64  // largest accepted /__down size; 0 means DefaultMaxBytes
+}
+
+// payload is the shared buffer /__down responses are written from.
+var payload = make([]byte, 64*1024)
+
+// Handler returns an http.Handler serving /__down, /__up and /cdn-cgi/trace.
+func Handler(opts Options) http.Handler {
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = DefaultMaxBytes
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/__down", opts.handleDown)
+	mux.HandleFunc("/__up", opts.handleUp)
+	mux.HandleFunc("/cdn-cgi/trace", opts.handleTrace)
+	return mux
+}
+
+// handleDown streams ?bytes=N bytes of payload.
+func (o Options) handleDown(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	n := int64(0)
+	if v := r.URL.Query().Get("bytes"); v != "" {
+		parsed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || parsed < 0 {
+			http.Error(w, "invalid bytes parameter", http.StatusBadRequest)
+			return
+		}
+		n = parsed
+	}
+	if n > o.MaxBytes {
+		http.Error(w, fmt.Sprintf("bytes exceeds limit of %d", o.MaxBytes), http.StatusBadRequest)
+		return
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "application/octet-stream")
+	h.Set("Content-Length", strconv.FormatInt(n, 10))
+	h.Set("Cache-Control", "no-store")
+	setServerTiming(h, start)
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	for n > 0 {
+		chunk := int64(len(payload))
+		if n < chunk {
+			chunk = n
+		}
+		written, err := w.Write(payload[:chunk])
+		if err != nil {
+			return
+		}
+		n -= int64(written)
+	}
+}
+
+// handleUp reads and discards the request body.
+func (o Options) handleUp(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if _, err := io.Copy(io.Discard, r.Body); err != nil {
+		http.Error(w, "reading body", http.StatusBadRequest)
+		return
+	}
+
+	h := w.Header()
+	h.Set("Cache-Control", "no-store")
+	setServerTiming(h, start)
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleTrace reports client and server metadata as key=value lines.
+func (o Options) handleTrace(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	scheme := "http"
+	tlsVersion := "off"
+	if r.TLS != nil {
+		scheme = "https"
+		tlsVersion = tls.VersionName(r.TLS.Version)
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "text/plain")
+	h.Set("Cache-Control", "no-store")
+	setServerTiming(h, start)
+
+	fmt.Fprintf(w, "h=%s\n", r.Host)
+	fmt.Fprintf(w, "ip=%s\n", ip)
+	fmt.Fprintf(w, "ts=%.3f\n", float64(time.Now().UnixMilli())/1000)
+	fmt.Fprintf(w, "visit_scheme=%s\n", scheme)
+	fmt.Fprintf(w, "uag=%s\n", r.UserAgent())
+	fmt.Fprintf(w, "colo=%s\n", o.Colo)
+	fmt.Fprintf(w, "http=%s\n", r.Proto)
+	fmt.Fprintf(w, "loc=%s\n", o.Location)
+	fmt.Fprintf(w, "tls=%s\n", tlsVersion)
+}
+
+// setServerTiming reports time spent handling the request so clients can
+// subtract it from measured round-trip times.
+func setServerTiming(h http.Header, start time.Time) {
+	dur := time.Since(start).Seconds() * 1000
+	h.Set("Server-Timing", fmt.Sprintf("cfRequestDuration;dur=%.3f", dur))
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/allenan/brr/internal/speedtest"
+)
+
+type nopCallback struct{}
+
+func (nopCallback) OnPhase(speedtest.Phase)                       {}
+func (nopCallback) OnDownloadSample(speedtest.Sample)             {}
+func (nopCallback) OnUploadSample(speedtest.Sample)               {}
+func (nopCallback) OnIdleLatencySample(speedtest.LatencySample)   {}
+func (nopCallback) OnLoadedLatencySample(speedtest.LatencySample) {}
+
+func TestDownSizes(t *testing.T) {
+	srv := httptest.NewServer(Handler(Options{MaxBytes: 1 << 20}))
+	defer srv.Close()
+
+	tests := []struct {
+		query      string
+		wantStatus int
+		wantLen    int
+	}{
+		{"bytes=0", http.StatusOK, 0},
+		{"bytes=100000", http.StatusOK, 100000},
+		{"bytes=-1", http.StatusBadRequest, -1},
+		{"bytes=abc", http.StatusBadRequest, -1},
+		{"bytes=2000000", http.StatusBadRequest, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			resp, err := http.Get(srv.URL + "/__down?" + tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantLen >= 0 && len(body) != tt.wantLen {
+				t.Errorf("body length = %d, want %d", len(body), tt.wantLen)
+			}
+			if tt.wantStatus == http.StatusOK && !strings.HasPrefix(resp.Header.Get("Server-Timing"), "cfRequestDuration;dur=") {
+				t.Errorf("Server-Timing = %q", resp.Header.Get("Server-Timing"))
+			}
+		})
+	}
+}
+
+func TestEngineAgainstServer(t *testing.T) {
+	srv := httptest.NewServer(Handler(Options{Colo: "SFO", Location: "US"}))
+	defer srv.Close()
+
+	backend, err := speedtest.ParseBackend(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := speedtest.NewEngine(backend)
+	engine.Config = speedtest.Config{
+		DownloadSequence: []speedtest.TransferSpec{{Bytes: 5_000_000, Count: 4}},
+		UploadSequence:   []speedtest.TransferSpec{{Bytes: 1_000_000, Count: 4}},
+		MaxConnections:   2,
+		SampleInterval:   5 * time.Millisecond,
+		LatencyProbes:    3,
+		LatencyInterval:  10 * time.Millisecond,
+	}
+
+	result, err := engine.Run(context.Background(), nopCallback{})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if result.Server.IP != "127.0.0.1" || result.Server.Colo != "SFO" || result.Server.Location != "US" {
+		t.Errorf("Server = %+v", result.Server)
+	}
+	if len(result.IdleLatency.Samples) != 3 {
+		t.Errorf("idle latency samples = %d, want 3", len(result.IdleLatency.Samples))
+	}
+}
+
+func TestPacketLossAgainstEcho(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ServeEcho(pc)
+	defer pc.Close()
+
+	cancel, ch := speedtest.MeasurePacketLoss(context.Background(), speedtest.FamilyAny, pc.LocalAddr().String(), time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	loss := <-ch
+
+	if loss == nil {
+		t.Fatal("MeasurePacketLoss returned nil")
+	}
+	if loss.Sent == 0 || loss.Received != loss.Sent || loss.LossPct != 0 {
+		t.Errorf("loss = %+v, want every probe echoed", loss)
+	}
+}
+
+func TestEchoAnswersOnlyProbes(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ServeEcho(pc)
+	defer pc.Close()
+
+	conn, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	probe := make([]byte, 64)
+	copy(probe, "brrE")
+	for _, packet := range [][]byte{
+		[]byte("hello"),
+		make([]byte, 64),          // no magic
+		append(probe[:4:4], 1, 2), // magic, but too short
+		append(probe, 0),          // magic, but too long
+	} {
+		conn.Write(packet)
+	}
+	conn.Write(probe)
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 2048)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("no reply to a probe: %v", err)
+	}
+	if !speedtest.IsLossProbe(buf[:n]) {
+		t.Errorf("first reply is %d bytes %q, want the probe; other datagrams must be dropped", n, buf[:min(n, 8)])
+	}
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if n, err := conn.Read(buf); err == nil {
+		t.Errorf("unexpected second reply of %d bytes", n)
+	}
+}
@@ -0,0 +1,141 @@
+package speedtest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// DefaultBaseURL is the base URL of Cloudflare's public speed test.
+const DefaultBaseURL = "https://speed.cloudflare.com"
+
+// Backend is a speed test server implementation. It tells the engine where
+// each phase sends its requests and how to look up server metadata.
+type Backend interface {
+	// FetchMeta retrieves metadata about the test server and client.
+	FetchMeta(ctx context.Context, client *http.Client) (*ServerInfo, error)
+	// DownloadURL returns a URL that serves n bytes of payload.
+	DownloadURL(n int, measID string) string
+	// UploadURL returns a URL that accepts and discards a request body.
+	UploadURL(measID string) string
+	// LatencyURL returns a URL used for lightweight round-trip probes.
+	LatencyURL() string
+	// Host returns the hostname (or IP) of the test server.
+	Host() string
+}
+
+// namedBackends maps --server names to their backends.
+var namedBackends = map[string]func() Backend{
+	"cloudflare": func() Backend { return NewCloudflare("") },
+}
+
+// ParseBackend resolves a server selection: either the name of a known
+// backend or the http(s) base URL of a server speaking the Cloudflare
+// protocol. An empty value selects the default backend.
+func ParseBackend(value string) (Backend, error) {
+	if value == "" {
+		return NewCloudflare(""), nil
+	}
+	if newBackend, ok := namedBackends[strings.ToLower(value)]; ok {
+		return newBackend(), nil
+	}
+
+	if !strings.Contains(value, "://") {
+		return nil, fmt.Errorf("unknown server %q: expected an http(s) URL or one of: %s", value, strings.Join(BackendNames(), ", "))
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server URL %q: %w", value, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid server URL %q: scheme must be http or https", value)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid server URL %q: missing host", value)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return nil, fmt.Errorf("invalid server URL %q: must not contain a query or fragment", value)
+	}
+	return NewCloudflare(u.String()), nil
+}
+
+// BackendNames returns the names accepted by ParseBackend, sorted.
+func BackendNames() []string {
+	names := make([]string, 0, len(namedBackends))
+	for name := range namedBackends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Cloudflare is a Backend speaking Cloudflare's speed test protocol
+// (/__down, /__up and /cdn-cgi/trace). It works against speed.cloudflare.com
+// or any mirror that implements the same endpoints.
+type Cloudflare struct {
+	BaseURL string
+}
+
+// NewCloudflare returns a Cloudflare backend rooted at baseURL, or at the
+// public Cloudflare endpoint if baseURL is empty.
+func NewCloudflare(baseURL string) *Cloudflare {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &Cloudflare{BaseURL: strings.TrimRight(baseURL, "/")}
+}
+
+// FetchMeta retrieves server metadata from the trace endpoint.
+func (c *Cloudflare) FetchMeta(ctx context.Context, client *http.Client) (*ServerInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/cdn-cgi/trace", nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating meta request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching meta: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching meta: unexpected status %s", resp.Status)
+	}
+
+	return parseTrace(resp.Body)
+}
+
+// DownloadURL returns the /__down URL for n bytes.
+func (c *Cloudflare) DownloadURL(n int, measID string) string {
+	u := fmt.Sprintf("%s/__down?bytes=%d", c.BaseURL, n)
+	if measID != "" {
+		u += "&measId=" + measID
+	}
+	return u
+}
+
+// UploadURL returns the /__up URL.
+func (c *Cloudflare) UploadURL(measID string) string {
+	u := c.BaseURL + "/__up"
+	if measID != "" {
+		u += "?measId=" + measID
+	}
+	return u
+}
+
+// LatencyURL returns a zero-byte /__down URL.
+func (c *Cloudflare) LatencyURL() string {
+	return c.BaseURL + "/__down?bytes=0"
+}
+
+// Host returns the hostname from BaseURL.
+func (c *Cloudflare) Host() string {
+	u, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
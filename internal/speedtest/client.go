@@ -1,18 +1,71 @@
 package speedtest
 
 import (
+	"context"
 	"crypto/tls"
 	"net"
 	"net/http"
+	"net/netip"
 	"strconv"
 	"strings"
 	"time"
 )
 
-const baseURL = "https://speed.cloudflare.com"
+// AddressFamily is the IP version a test runs over.
+type AddressFamily string
 
-// NewHTTPClient creates an HTTP/2 client optimized for speed testing.
-func NewHTTPClient() *http.Client {
+const (
+	FamilyAny  AddressFamily = "" // whichever the system prefers
+	FamilyIPv4 AddressFamily = "ipv4"
+	FamilyIPv6 AddressFamily = "ipv6"
+)
+
+// Network returns the network name for proto ("tcp", "udp" or "ip")
+// restricted to f, e.g. "tcp6".
+func (f AddressFamily) Network(proto string) string {
+	switch f {
+	case FamilyIPv4:
+		return proto + "4"
+	case FamilyIPv6:
+		return proto + "6"
+	default:
+		return proto
+	}
+}
+
+// String returns "IPv4" or "IPv6", for display.
+func (f AddressFamily) String() string {
+	switch f {
+	case FamilyIPv4:
+		return "IPv4"
+	case FamilyIPv6:
+		return "IPv6"
+	default:
+		return "any"
+	}
+}
+
+// familyOf returns the family of the IP address ip, or FamilyAny if it
+// doesn't parse.
+func familyOf(ip string) AddressFamily {
+	addr, err := netip.ParseAddr(ip)
+	switch {
+	case err != nil:
+		return FamilyAny
+	case addr.Unmap().Is4():
+		return FamilyIPv4
+	default:
+		return FamilyIPv6
+	}
+}
+
+// NewHTTPClient creates an HTTP/2 client optimized for speed testing that
+// connects over family only, unless it is FamilyAny.
+func NewHTTPClient(family AddressFamily) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
 	transport := &http.Transport{
 		TLSClientConfig: &tls.Config{
 			InsecureSkipVerify: false,
@@ -22,10 +75,9 @@ func NewHTTPClient() *http.Client {
 		MaxIdleConnsPerHost: 16,
 		MaxConnsPerHost:     0, // unlimited
 		DisableCompression:  true,
-		DialContext: (&net.Dialer{
-			Timeout:   10 * time.Second,
-			KeepAlive: 30 * time.Second,
-		}).DialContext,
+		DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, family.Network("tcp"), addr)
+		},
 		TLSHandshakeTimeout: 10 * time.Second,
 		IdleConnTimeout:     90 * time.Second,
 	}
@@ -35,6 +87,33 @@ func NewHTTPClient() *http.Client {
 	}
 }
 
+// transferClient returns a client with base's transport settings that speaks
+// HTTP/1.1 only, so each concurrent transfer gets a TCP connection of its
+// own. Over HTTP/2 they would all be streams on one connection, and adding
+// transfers would not add connections.
+func transferClient(base *http.Client) *http.Client {
+	transport, ok := base.Transport.(*http.Transport)
+	if !ok {
+		transport = http.DefaultTransport.(*http.Transport)
+	}
+	transport = transport.Clone()
+	transport.ForceAttemptHTTP2 = false
+	transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	// base may already offer h2 in the TLS handshake; offer only HTTP/1.1
+	if transport.TLSClientConfig != nil {
+		transport.TLSClientConfig = transport.TLSClientConfig.Clone()
+	} else {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	transport.TLSClientConfig.NextProtos = []string{"http/1.1"}
+	// Keep every worker's connection between rounds
+	transport.MaxIdleConnsPerHost = transport.MaxIdleConns
+	return &http.Client{
+		Transport: transport,
+		Timeout:   base.Timeout,
+	}
+}
+
 // parseServerTiming extracts cfRequestDuration from the Server-Timing header.
 // Returns the duration in milliseconds, or 0 if not found.
 func parseServerTiming(header string) float64 {
@@ -10,12 +10,20 @@ type TransferSpec struct {
 
 // Config holds all tunable parameters for a speed test run.
 type Config struct {
-	DownloadSequence []TransferSpec
-	UploadSequence   []TransferSpec
-	MaxConnections   int
-	SampleInterval   time.Duration
-	LatencyProbes    int
-	LatencyInterval  time.Duration // interval for loaded latency probes
+	DownloadSequence   []TransferSpec
+	UploadSequence     []TransferSpec
+	PhaseDuration      time.Duration // if set, run download/upload for this long instead of the sequences
+	FullDuration       bool          // with PhaseDuration, don't end a phase early once throughput is stable
+	NoDownload         bool          // skip the download phase
+	NoUpload           bool          // skip the upload phase
+	Bidirectional      bool          // after the upload phase, download and upload at the same time
+	InitialConnections int           // parallel connections to start with (0 = MaxConnections); grows while throughput improves
+	MaxConnections     int
+	SampleInterval     time.Duration
+	LatencyProbes      int
+	SetupProbes        int           // fresh-connection probes after idle latency, for the DNS/TCP/TLS breakdown
+	LatencyInterval    time.Duration // interval for loaded latency probes
+	LossInterval       time.Duration // interval between UDP packet loss probes
 }
 
 // DefaultConfig returns the default speed test configuration.
@@ -32,9 +40,12 @@ func DefaultConfig() Config {
 			{Bytes: 101_000, Count: 10},
 			{Bytes: 1_000_000, Count: 8},
 		},
-		MaxConnections:  16,
-		SampleInterval:  100 * time.Millisecond,
-		LatencyProbes:   20,
-		LatencyInterval: 400 * time.Millisecond,
+		InitialConnections: 4,
+		MaxConnections:     16,
+		SampleInterval:     100 * time.Millisecond,
+		LatencyProbes:      20,
+		SetupProbes:        5,
+		LatencyInterval:    400 * time.Millisecond,
+		LossInterval:       20 * time.Millisecond,
 	}
 }
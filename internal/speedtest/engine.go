@@ -4,74 +4,151 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"slices"
+	"sync"
 	"time"
 )
 
 // Engine orchestrates a complete speed test sequence.
 type Engine struct {
-	Client *http.Client
-	Config Config
+	Client   *http.Client
+	Backend  Backend
+	Config   Config
+	EchoAddr string // UDP echo server (host:port) for packet loss probes; empty disables them
+
+	// Family restricts the test to IPv4 or IPv6. Client must have been
+	// created with NewHTTPClient(Family); see UseFamily.
+	Family AddressFamily
 }
 
-// NewEngine creates a new speed test engine with default config.
-func NewEngine() *Engine {
+// NewEngine creates a new speed test engine with default config that tests
+// against backend. A nil backend selects the default Cloudflare backend.
+func NewEngine(backend Backend) *Engine {
+	if backend == nil {
+		backend = NewCloudflare("")
+	}
 	return &Engine{
-		Client: NewHTTPClient(),
-		Config: DefaultConfig(),
+		Client:  NewHTTPClient(FamilyAny),
+		Backend: backend,
+		Config:  DefaultConfig(),
 	}
 }
 
+// UseFamily restricts e to family, replacing its client with one that only
+// connects over it.
+func (e *Engine) UseFamily(family AddressFamily) {
+	e.Family = family
+	e.Client = NewHTTPClient(family)
+}
+
 // Run executes the full speed test sequence, calling cb for progress updates.
 func (e *Engine) Run(ctx context.Context, cb ProgressCallback) (*Result, error) {
 	result := &Result{
 		Timestamp: time.Now(),
+		Status:    StatusOK,
 	}
 
 	// Phase 1: Metadata
 	cb.OnPhase(PhaseMeta)
-	meta, err := FetchMeta(ctx, e.Client)
+	meta, err := e.Backend.FetchMeta(ctx, e.Client)
 	if err != nil {
 		return nil, fmt.Errorf("metadata: %w", err)
 	}
 	result.Server = *meta
+	result.Server.AddressFamily = familyOf(meta.IP)
+	if result.Server.AddressFamily == FamilyAny {
+		// The backend didn't report our address; go by what we dialed
+		result.Server.AddressFamily = e.Family
+	}
 
 	measID := fmt.Sprintf("%d", time.Now().UnixNano())
+	freshClient := freshConnClient(e.Client)
+	transfers := transferClient(e.Client)
 
 	// Phase 2: Idle Latency
 	cb.OnPhase(PhaseLatency)
-	idleLatency, err := MeasureIdleLatency(ctx, e.Client, e.Config.LatencyProbes, cb.OnIdleLatencySample)
+	stopIdleLoss := e.startLossProbe(ctx)
+	idleLatency, err := MeasureIdleLatency(ctx, e.Client, e.Backend, e.Config.LatencyProbes, cb.OnIdleLatencySample)
+	idleLoss := stopIdleLoss()
 	if err != nil {
 		return nil, fmt.Errorf("idle latency: %w", err)
 	}
+	idleLatency.Loss = idleLoss
+	setup := measureSetupProbes(ctx, freshClient, e.Backend, e.Config.SetupProbes)
+	idleLatency.Breakdown = computeBreakdown(append(slices.Clip(idleLatency.Samples), setup...))
 	result.IdleLatency = *idleLatency
 
 	// Phase 3: Download + Loaded Latency
-	cb.OnPhase(PhaseDownload)
-	cancelDLLatency, dlLatencyCh := MeasureLoadedLatency(ctx, e.Client, e.Config.LatencyInterval, cb.OnLoadedLatencySample)
+	// Responsiveness pools the probes from the loaded phases that run
+	var foreign, self []LatencySample
+	if !e.Config.NoDownload {
+		cb.OnPhase(PhaseDownload)
+		cancelDLLatency, dlLatencyCh := MeasureLoadedLatency(ctx, e.Client, e.Backend, e.Config.LatencyInterval, cb.OnLoadedLatencySample)
+		cancelDLForeign, dlForeignCh := measureForeignProbes(ctx, freshClient, e.Backend, e.Config.LatencyInterval)
+		stopDLLoss := e.startLossProbe(ctx)
 
-	dlResult, err := MeasureDownload(ctx, e.Client, e.Config, measID, cb.OnDownloadSample)
-	cancelDLLatency()
-	dlLatency := <-dlLatencyCh
-	if err != nil {
-		return nil, fmt.Errorf("download: %w", err)
+		dlResult, err := MeasureDownload(ctx, transfers, e.Backend, e.Config, measID, cb.OnDownloadSample)
+		cancelDLLatency()
+		cancelDLForeign()
+		dlLatency := <-dlLatencyCh
+		dlForeign := <-dlForeignCh
+		dlLatency.Loss = stopDLLoss()
+		if err != nil {
+			return nil, fmt.Errorf("download: %w", err)
+		}
+		dlLatency.Breakdown = computeBreakdown(append(slices.Clip(dlLatency.Samples), dlForeign...))
+		result.Download = dlResult
+		result.DownloadLatency = dlLatency
+		result.BufferbloatDL = BufferbloatGrading(idleLatency, dlLatency)
+		foreign = append(foreign, dlForeign...)
+		self = append(self, dlLatency.Samples...)
 	}
-	result.Download = *dlResult
-	result.DownloadLatency = *dlLatency
-	result.BufferbloatDL = BufferbloatGrading(idleLatency, dlLatency)
 
 	// Phase 4: Upload + Loaded Latency
-	cb.OnPhase(PhaseUpload)
-	cancelULLatency, ulLatencyCh := MeasureLoadedLatency(ctx, e.Client, e.Config.LatencyInterval, cb.OnLoadedLatencySample)
+	if !e.Config.NoUpload {
+		cb.OnPhase(PhaseUpload)
+		cancelULLatency, ulLatencyCh := MeasureLoadedLatency(ctx, e.Client, e.Backend, e.Config.LatencyInterval, cb.OnLoadedLatencySample)
+		cancelULForeign, ulForeignCh := measureForeignProbes(ctx, freshClient, e.Backend, e.Config.LatencyInterval)
+		stopULLoss := e.startLossProbe(ctx)
 
-	ulResult, err := MeasureUpload(ctx, e.Client, e.Config, measID, cb.OnUploadSample)
-	cancelULLatency()
-	ulLatency := <-ulLatencyCh
-	if err != nil {
-		return nil, fmt.Errorf("upload: %w", err)
+		ulResult, err := MeasureUpload(ctx, transfers, e.Backend, e.Config, measID, cb.OnUploadSample)
+		cancelULLatency()
+		cancelULForeign()
+		ulLatency := <-ulLatencyCh
+		ulForeign := <-ulForeignCh
+		ulLatency.Loss = stopULLoss()
+		if err != nil {
+			return nil, fmt.Errorf("upload: %w", err)
+		}
+		ulLatency.Breakdown = computeBreakdown(append(slices.Clip(ulLatency.Samples), ulForeign...))
+		result.Upload = ulResult
+		result.UploadLatency = ulLatency
+		result.BufferbloatUL = BufferbloatGrading(idleLatency, ulLatency)
+		foreign = append(foreign, ulForeign...)
+		self = append(self, ulLatency.Samples...)
+	}
+
+	result.Responsiveness = computeResponsiveness(foreign, self)
+
+	// Phase 5: Download and Upload together + Loaded Latency
+	if e.Config.Bidirectional {
+		cb.OnPhase(PhaseBidirectional)
+		cancelLatency, latencyCh := MeasureLoadedLatency(ctx, e.Client, e.Backend, e.Config.LatencyInterval, cb.OnLoadedLatencySample)
+		stopLoss := e.startLossProbe(ctx)
+
+		dlResult, ulResult, err := e.measureBidirectional(ctx, transfers, measID)
+		cancelLatency()
+		latency := <-latencyCh
+		latency.Loss = stopLoss()
+		if err != nil {
+			return nil, fmt.Errorf("bidirectional: %w", err)
+		}
+		latency.Breakdown = computeBreakdown(latency.Samples)
+		result.BidirDownload = dlResult
+		result.BidirUpload = ulResult
+		result.BidirLatency = latency
+		result.BufferbloatBidir = BufferbloatGrading(idleLatency, latency)
 	}
-	result.Upload = *ulResult
-	result.UploadLatency = *ulLatency
-	result.BufferbloatUL = BufferbloatGrading(idleLatency, ulLatency)
 
 	result.ContextLine = ContextLine(result)
 
@@ -79,3 +156,57 @@ func (e *Engine) Run(ctx context.Context, cb ProgressCallback) (*Result, error)
 	cb.OnPhase(PhaseDone)
 	return result, nil
 }
+
+// measureBidirectional runs a download and an upload at the same time. If
+// either fails, the other is cancelled and the first error is returned.
+// Throughput samples aren't reported to the callback; they would be mistaken
+// for the single-direction phases.
+func (e *Engine) measureBidirectional(ctx context.Context, client *http.Client, measID string) (dl, ul *PhaseResult, err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var once sync.Once
+	fail := func(phase string, phaseErr error) {
+		once.Do(func() {
+			err = fmt.Errorf("%s: %w", phase, phaseErr)
+			cancel()
+		})
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		var dlErr error
+		if dl, dlErr = MeasureDownload(ctx, client, e.Backend, e.Config, measID, nil); dlErr != nil {
+			fail("download", dlErr)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		var ulErr error
+		if ul, ulErr = MeasureUpload(ctx, client, e.Backend, e.Config, measID, nil); ulErr != nil {
+			fail("upload", ulErr)
+		}
+	}()
+	wg.Wait()
+	if err != nil {
+		return nil, nil, err
+	}
+	return dl, ul, nil
+}
+
+// startLossProbe starts a packet loss probe over e.Family if an echo server
+// is configured.
+// The returned function stops the probe and returns its result, which is nil
+// when probing is disabled or the echo server could not be reached.
+func (e *Engine) startLossProbe(ctx context.Context) func() *PacketLoss {
+	if e.EchoAddr == "" {
+		return func() *PacketLoss { return nil }
+	}
+	cancel, ch := MeasurePacketLoss(ctx, e.Family, e.EchoAddr, e.Config.LossInterval)
+	return func() *PacketLoss {
+		cancel()
+		return <-ch
+	}
+}
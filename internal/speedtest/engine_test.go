@@ -0,0 +1,286 @@
+package speedtest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type nopCallback struct{}
+
+func (nopCallback) OnPhase(Phase)                       {}
+func (nopCallback) OnDownloadSample(Sample)             {}
+func (nopCallback) OnUploadSample(Sample)               {}
+func (nopCallback) OnIdleLatencySample(LatencySample)   {}
+func (nopCallback) OnLoadedLatencySample(LatencySample) {}
+
+// newTestEngine returns an engine with a small configuration against a
+// local server speaking the Cloudflare protocol. transfers counts the
+// download and upload requests the server sees, not counting zero-byte
+// latency probes.
+func newTestEngine(t *testing.T) (engine *Engine, transfers *atomic.Int64) {
+	t.Helper()
+	return newTestEngineOn(t, "127.0.0.1:0")
+}
+
+// newTestEngineOn is newTestEngine with the server listening on addr. It
+// skips the test if addr isn't available, e.g. [::1] without IPv6.
+func newTestEngineOn(t *testing.T, addr string) (engine *Engine, transfers *atomic.Int64) {
+	t.Helper()
+	transfers = new(atomic.Int64)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cdn-cgi/trace", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ip=127.0.0.1\ncolo=SFO\nloc=US\n")
+	})
+	mux.HandleFunc("/__down", func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(r.URL.Query().Get("bytes"))
+		if n > 0 {
+			transfers.Add(1)
+		}
+		w.Header().Set("Server-Timing", "cfRequestDuration;dur=0.1")
+		w.Write(make([]byte, n))
+	})
+	mux.HandleFunc("/__up", func(w http.ResponseWriter, r *http.Request) {
+		transfers.Add(1)
+		io.Copy(io.Discard, r.Body)
+	})
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("listening on %s: %v", addr, err)
+	}
+	srv := httptest.NewUnstartedServer(mux)
+	srv.Listener.Close()
+	srv.Listener = l
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	backend, err := ParseBackend(srv.URL)
+	if err != nil {
+		t.Fatalf("ParseBackend() error = %v", err)
+	}
+	engine = NewEngine(backend)
+	engine.Config = Config{
+		DownloadSequence: []TransferSpec{{Bytes: 1_000_000, Count: 4}},
+		UploadSequence:   []TransferSpec{{Bytes: 100_000, Count: 4}},
+		MaxConnections:   2,
+		SampleInterval:   10 * time.Millisecond,
+		LatencyProbes:    3,
+		SetupProbes:      2,
+		LatencyInterval:  10 * time.Millisecond,
+	}
+	return engine, transfers
+}
+
+func TestEngineRunAgainstTestServer(t *testing.T) {
+	engine, _ := newTestEngine(t)
+
+	result, err := engine.Run(context.Background(), nopCallback{})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if result.Server.Colo != "SFO" || result.Server.ColoCity != "San Francisco, CA" {
+		t.Errorf("Server = %+v, want colo SFO", result.Server)
+	}
+	if len(result.IdleLatency.Samples) != 3 {
+		t.Errorf("idle latency samples = %d, want 3", len(result.IdleLatency.Samples))
+	}
+	if b := result.IdleLatency.Breakdown; b == nil || b.Connect.Count < 2 || b.TTFB.Count == 0 {
+		t.Errorf("idle breakdown = %+v, want connect and TTFB stages", b)
+	}
+}
+
+type phaseRecorder struct {
+	nopCallback
+	phases []Phase
+}
+
+func (r *phaseRecorder) OnPhase(p Phase) { r.phases = append(r.phases, p) }
+
+func TestEngineSkipsDisabledPhases(t *testing.T) {
+	engine, transfers := newTestEngine(t)
+	engine.Config.NoDownload = true
+	engine.Config.NoUpload = true
+
+	rec := &phaseRecorder{}
+	result, err := engine.Run(context.Background(), rec)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if want := []Phase{PhaseMeta, PhaseLatency, PhaseDone}; fmt.Sprint(rec.phases) != fmt.Sprint(want) {
+		t.Errorf("phases = %v, want %v", rec.phases, want)
+	}
+	if n := transfers.Load(); n != 0 {
+		t.Errorf("%d transfers made, want none", n)
+	}
+	if len(result.IdleLatency.Samples) != 3 || result.Download != nil || result.UploadLatency != nil || result.Responsiveness != nil {
+		t.Errorf("result = %+v, want idle latency only", result)
+	}
+
+	engine.Config.NoDownload = false
+	rec.phases = nil
+	result, err = engine.Run(context.Background(), rec)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if want := []Phase{PhaseMeta, PhaseLatency, PhaseDownload, PhaseDone}; fmt.Sprint(rec.phases) != fmt.Sprint(want) {
+		t.Errorf("phases = %v, want %v", rec.phases, want)
+	}
+	if result.Download == nil || result.DownloadLatency == nil || result.BufferbloatDL == "" {
+		t.Errorf("result = %+v, want a download phase", result)
+	}
+	if result.Upload != nil || result.UploadLatency != nil || result.BufferbloatUL != "" {
+		t.Errorf("result = %+v, want no upload phase", result)
+	}
+}
+
+func TestEngineBidirectional(t *testing.T) {
+	engine, _ := newTestEngine(t)
+	engine.Config.NoDownload = true
+	engine.Config.NoUpload = true
+	engine.Config.Bidirectional = true
+
+	rec := &phaseRecorder{}
+	result, err := engine.Run(context.Background(), rec)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if want := []Phase{PhaseMeta, PhaseLatency, PhaseBidirectional, PhaseDone}; fmt.Sprint(rec.phases) != fmt.Sprint(want) {
+		t.Errorf("phases = %v, want %v", rec.phases, want)
+	}
+	if dl, ul := result.BidirDownload, result.BidirUpload; dl == nil || ul == nil {
+		t.Errorf("bidirectional download %+v, upload %+v, want both measured", dl, ul)
+	}
+	if result.BidirLatency == nil || result.BufferbloatBidir == "" {
+		t.Errorf("bidirectional latency %+v, grade %q, want both", result.BidirLatency, result.BufferbloatBidir)
+	}
+	if result.Download != nil || result.Upload != nil {
+		t.Errorf("single-direction phases ran: %+v", result)
+	}
+}
+
+func TestEngineAddressFamily(t *testing.T) {
+	engine, _ := newTestEngine(t)
+	engine.Config.NoDownload, engine.Config.NoUpload = true, true
+
+	engine.UseFamily(FamilyIPv4)
+	result, err := engine.Run(context.Background(), nopCallback{})
+	if err != nil {
+		t.Fatalf("Run() over IPv4 error = %v", err)
+	}
+	if result.Server.AddressFamily != FamilyIPv4 {
+		t.Errorf("AddressFamily = %q, want %q", result.Server.AddressFamily, FamilyIPv4)
+	}
+
+	// The test server only listens on 127.0.0.1
+	engine.UseFamily(FamilyIPv6)
+	if _, err := engine.Run(context.Background(), nopCallback{}); err == nil {
+		t.Error("Run() over IPv6 succeeded against an IPv4-only server")
+	}
+
+	t.Run("loss probe", func(t *testing.T) {
+		pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pc.Close()
+		go func() {
+			buf := make([]byte, 1500)
+			for {
+				n, addr, err := pc.ReadFrom(buf)
+				if err != nil {
+					return
+				}
+				pc.WriteTo(buf[:n], addr)
+			}
+		}()
+
+		run := func(engine *Engine) *PacketLoss {
+			t.Helper()
+			engine.Config.NoDownload, engine.Config.NoUpload = true, true
+			engine.Config.LossInterval = time.Millisecond
+			engine.EchoAddr = pc.LocalAddr().String()
+			result, err := engine.Run(context.Background(), nopCallback{})
+			if err != nil {
+				t.Fatalf("Run() over %s error = %v", engine.Family, err)
+			}
+			return result.IdleLatency.Loss
+		}
+
+		v4, _ := newTestEngine(t)
+		v4.UseFamily(FamilyIPv4)
+		if loss := run(v4); loss == nil || loss.Received == 0 {
+			t.Errorf("IPv4 loss = %+v, want probes echoed by the IPv4 echo server", loss)
+		}
+
+		// The HTTP test runs over IPv6; the echo server is IPv4 only, so the
+		// probe must not fall back to it
+		v6, _ := newTestEngineOn(t, "[::1]:0")
+		v6.UseFamily(FamilyIPv6)
+		if loss := run(v6); loss != nil {
+			t.Errorf("IPv6 loss = %+v, want nil: the probe reached the IPv4 echo server", loss)
+		}
+	})
+}
+
+func TestEngineTransfersUseSeparateConnections(t *testing.T) {
+	var mu sync.Mutex
+	transferConns := map[string]bool{} // by client address
+	var probeProto string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cdn-cgi/trace", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ip=127.0.0.1\ncolo=SFO\nloc=US\n")
+	})
+	mux.HandleFunc("/__down", func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(r.URL.Query().Get("bytes"))
+		mu.Lock()
+		if n > 0 {
+			transferConns[r.RemoteAddr] = true
+		} else {
+			probeProto = r.Proto
+		}
+		mu.Unlock()
+		w.Write(make([]byte, n))
+	})
+	srv := httptest.NewUnstartedServer(mux)
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	backend, err := ParseBackend(srv.URL)
+	if err != nil {
+		t.Fatalf("ParseBackend() error = %v", err)
+	}
+	engine := NewEngine(backend)
+	engine.Client.Transport.(*http.Transport).TLSClientConfig = srv.Client().Transport.(*http.Transport).TLSClientConfig
+	engine.Config = Config{
+		DownloadSequence:   []TransferSpec{{Bytes: 1_000_000, Count: 16}},
+		InitialConnections: 4,
+		MaxConnections:     4,
+		SampleInterval:     10 * time.Millisecond,
+		LatencyProbes:      3,
+		LatencyInterval:    10 * time.Millisecond,
+		NoUpload:           true,
+	}
+	if _, err := engine.Run(context.Background(), nopCallback{}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// Latency probes still use HTTP/2, which would multiplex the transfers
+	// onto one connection
+	if probeProto != "HTTP/2.0" {
+		t.Fatalf("probes used %q, want HTTP/2.0 for a meaningful test", probeProto)
+	}
+	if n := len(transferConns); n < 2 || n > 4 {
+		t.Errorf("download used %d connections, want one per worker (up to 4)", n)
+	}
+}
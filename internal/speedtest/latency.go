@@ -3,13 +3,12 @@ package speedtest
 import (
 	"context"
 	"fmt"
-	"io"
 	"net/http"
 	"time"
 )
 
 // MeasureIdleLatency performs count sequential latency probes and reports each via onSample.
-func MeasureIdleLatency(ctx context.Context, client *http.Client, count int, onSample func(LatencySample)) (*LatencyResult, error) {
+func MeasureIdleLatency(ctx context.Context, client *http.Client, backend Backend, count int, onSample func(LatencySample)) (*LatencyResult, error) {
 	var samples []LatencySample
 
 	for i := 0; i < count; i++ {
@@ -19,15 +18,10 @@ func MeasureIdleLatency(ctx context.Context, client *http.Client, count int, onS
 		default:
 		}
 
-		rtt, err := probeLatency(ctx, client)
+		s, err := probeLatency(ctx, client, backend)
 		if err != nil {
 			continue // skip failed probes
 		}
-
-		s := LatencySample{
-			Timestamp: time.Now(),
-			RTT:       rtt,
-		}
 		samples = append(samples, s)
 		if onSample != nil {
 			onSample(s)
@@ -43,7 +37,7 @@ func MeasureIdleLatency(ctx context.Context, client *http.Client, count int, onS
 
 // MeasureLoadedLatency runs latency probes in the background at the given interval.
 // Returns a cancel function and a channel that receives the result when cancelled.
-func MeasureLoadedLatency(ctx context.Context, client *http.Client, interval time.Duration, onSample func(LatencySample)) (cancel func(), resultCh <-chan *LatencyResult) {
+func MeasureLoadedLatency(ctx context.Context, client *http.Client, backend Backend, interval time.Duration, onSample func(LatencySample)) (cancel func(), resultCh <-chan *LatencyResult) {
 	ctx, cancelFn := context.WithCancel(ctx)
 	ch := make(chan *LatencyResult, 1)
 
@@ -62,14 +56,10 @@ func MeasureLoadedLatency(ctx context.Context, client *http.Client, interval tim
 				}
 				return
 			case <-ticker.C:
-				rtt, err := probeLatency(ctx, client)
+				s, err := probeLatency(ctx, client, backend)
 				if err != nil {
 					continue
 				}
-				s := LatencySample{
-					Timestamp: time.Now(),
-					RTT:       rtt,
-				}
 				samples = append(samples, s)
 				if onSample != nil {
 					onSample(s)
@@ -81,29 +71,26 @@ func MeasureLoadedLatency(ctx context.Context, client *http.Client, interval tim
 	return cancelFn, ch
 }
 
-// probeLatency makes a single latency measurement to __down?bytes=0.
-func probeLatency(ctx context.Context, client *http.Client) (float64, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/__down?bytes=0", nil)
-	if err != nil {
-		return 0, err
-	}
+// probeLatency makes a single latency measurement against the backend's
+// latency URL.
+func probeLatency(ctx context.Context, client *http.Client, backend Backend) (LatencySample, error) {
+	s, _, err := traceProbe(ctx, client, backend.LatencyURL())
+	return s, err
+}
 
-	start := time.Now()
-	resp, err := client.Do(req)
-	if err != nil {
-		return 0, err
-	}
-	io.Copy(io.Discard, resp.Body)
-	resp.Body.Close()
-	elapsed := time.Since(start).Seconds() * 1000 // ms
-
-	serverTime := parseServerTiming(resp.Header.Get("Server-Timing"))
-	rtt := elapsed - serverTime
-	if rtt < 0 {
-		rtt = elapsed
+// measureSetupProbes makes count sequential probes on fresh connections so
+// that the DNS, TCP and TLS stages show up in the idle breakdown. Failed
+// probes are skipped.
+func measureSetupProbes(ctx context.Context, client *http.Client, backend Backend, count int) []LatencySample {
+	var samples []LatencySample
+	for i := 0; i < count && ctx.Err() == nil; i++ {
+		s, err := probeLatency(ctx, client, backend)
+		if err != nil {
+			continue
+		}
+		samples = append(samples, s)
 	}
-
-	return rtt, nil
+	return samples
 }
 
 func computeLatencyResult(samples []LatencySample) *LatencyResult {
@@ -117,6 +104,7 @@ func computeLatencyResult(samples []LatencySample) *LatencyResult {
 		Avg:     mean(rtts),
 		Jitter:  Jitter(rtts),
 	}
+	result.Breakdown = computeBreakdown(samples)
 
 	if len(rtts) > 0 {
 		result.Min = rtts[0]
@@ -144,3 +132,49 @@ func mean(vals []float64) float64 {
 	}
 	return sum / float64(len(vals))
 }
+
+// computeBreakdown aggregates the per-stage timings of samples. Each stage is
+// summarized over the probes in which it occurred. Returns nil if samples is
+// empty.
+func computeBreakdown(samples []LatencySample) *LatencyBreakdown {
+	if len(samples) == 0 {
+		return nil
+	}
+	var dns, connect, tlsTimes, ttfb []float64
+	for _, s := range samples {
+		if s.DNS > 0 {
+			dns = append(dns, s.DNS)
+		}
+		if s.Connect > 0 {
+			connect = append(connect, s.Connect)
+		}
+		if s.TLS > 0 {
+			tlsTimes = append(tlsTimes, s.TLS)
+		}
+		if s.TTFB > 0 {
+			ttfb = append(ttfb, s.TTFB)
+		}
+	}
+	return &LatencyBreakdown{
+		DNS:     computeStageStats(dns),
+		Connect: computeStageStats(connect),
+		TLS:     computeStageStats(tlsTimes),
+		TTFB:    computeStageStats(ttfb),
+	}
+}
+
+func computeStageStats(vals []float64) StageStats {
+	if len(vals) == 0 {
+		return StageStats{}
+	}
+	st := StageStats{Avg: mean(vals), Min: vals[0], Max: vals[0], Count: len(vals)}
+	for _, v := range vals {
+		if v < st.Min {
+			st.Min = v
+		}
+		if v > st.Max {
+			st.Max = v
+		}
+	}
+	return st
+}
@@ -0,0 +1,138 @@
+package speedtest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+)
+
+// Packet loss probe wire format: a 4-byte magic, a 4-byte session ID and a
+// 4-byte sequence number, padded to lossPacketSize. The echo server returns
+// the packet unchanged, so any RFC 862 style UDP echo service works.
+const (
+	lossMagic      = "brrE"
+	lossPacketSize = 64
+
+	// lossGrace is how long to wait for late replies after the last send.
+	lossGrace = 500 * time.Millisecond
+
+	// lossMinPackets is the fewest probes sent before a result is reported,
+	// so short phases still yield a meaningful percentage.
+	lossMinPackets = 50
+)
+
+// MeasurePacketLoss sends UDP echo probes to addr at the given interval in the
+// background, over family only unless it is FamilyAny. Returns a cancel
+// function and a channel that receives the result when cancelled. The result
+// is nil if the probe could not be started.
+func MeasurePacketLoss(ctx context.Context, family AddressFamily, addr string, interval time.Duration) (cancel func(), resultCh <-chan *PacketLoss) {
+	parent := ctx
+	ctx, cancelFn := context.WithCancel(ctx)
+	ch := make(chan *PacketLoss, 1)
+
+	go func() {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, family.Network("udp"), addr)
+		if err != nil {
+			ch <- nil
+			return
+		}
+		defer conn.Close()
+
+		var session [4]byte
+		if _, err := rand.Read(session[:]); err != nil {
+			ch <- nil
+			return
+		}
+
+		var (
+			mu        sync.Mutex
+			sent      int
+			received  = make(map[uint32]bool)
+			highest   = -1
+			reordered int
+		)
+
+		// Receiver
+		recvDone := make(chan struct{})
+		go func() {
+			defer close(recvDone)
+			buf := make([]byte, lossPacketSize)
+			for {
+				n, err := conn.Read(buf)
+				if err != nil {
+					return // closed or deadline reached
+				}
+				if n < 12 || string(buf[:4]) != lossMagic || string(buf[4:8]) != string(session[:]) {
+					continue
+				}
+				seq := binary.BigEndian.Uint32(buf[8:12])
+
+				mu.Lock()
+				if int(seq) < sent && !received[seq] {
+					received[seq] = true
+					if int(seq) < highest {
+						reordered++
+					} else {
+						highest = int(seq)
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+
+		// Sender
+		packet := make([]byte, lossPacketSize)
+		copy(packet, lossMagic)
+		copy(packet[4:], session[:])
+		sendOne := func() {
+			mu.Lock()
+			binary.BigEndian.PutUint32(packet[8:], uint32(sent))
+			sent++
+			mu.Unlock()
+			conn.Write(packet) // a failed send counts as lost
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		sendOne()
+		for ctx.Err() == nil || (parent.Err() == nil && sent < lossMinPackets) {
+			<-ticker.C
+			sendOne()
+		}
+
+		// Wait for stragglers, then stop the receiver
+		conn.SetReadDeadline(time.Now().Add(lossGrace))
+		<-recvDone
+
+		mu.Lock()
+		defer mu.Unlock()
+		ch <- computePacketLoss(sent, len(received), reordered)
+	}()
+
+	return cancelFn, ch
+}
+
+// IsLossProbe reports whether b is a packet loss probe as sent by
+// MeasurePacketLoss, for echo servers that answer nothing else.
+func IsLossProbe(b []byte) bool {
+	return len(b) == lossPacketSize && string(b[:len(lossMagic)]) == lossMagic
+}
+
+func computePacketLoss(sent, received, reordered int) *PacketLoss {
+	result := &PacketLoss{
+		Sent:      sent,
+		Received:  received,
+		Reordered: reordered,
+	}
+	if sent > 0 {
+		result.LossPct = float64(sent-received) / float64(sent) * 100
+	}
+	if received > 0 {
+		result.ReorderPct = float64(reordered) / float64(received) * 100
+	}
+	return result
+}
@@ -2,9 +2,7 @@ package speedtest
 
 import (
 	"bufio"
-	"context"
-	"fmt"
-	"net/http"
+	"io"
 	"strings"
 )
 
@@ -74,21 +72,10 @@ func ColoName(code string) string {
 	return code
 }
 
-// FetchMeta retrieves server metadata from Cloudflare's trace endpoint.
-func FetchMeta(ctx context.Context, client *http.Client) (*ServerInfo, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/cdn-cgi/trace", nil)
-	if err != nil {
-		return nil, fmt.Errorf("creating meta request: %w", err)
-	}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("fetching meta: %w", err)
-	}
-	defer resp.Body.Close()
-
+// parseTrace parses a key=value trace body into a ServerInfo.
+func parseTrace(r io.Reader) (*ServerInfo, error) {
 	info := &ServerInfo{}
-	scanner := bufio.NewScanner(resp.Body)
+	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
 		line := scanner.Text()
 		parts := strings.SplitN(line, "=", 2)
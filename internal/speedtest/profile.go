@@ -0,0 +1,66 @@
+package speedtest
+
+import (
+	"sort"
+	"time"
+)
+
+// DefaultProfile is the profile DefaultConfig corresponds to.
+const DefaultProfile = "standard"
+
+// profiles are the built-in test profiles.
+var profiles = map[string]func() Config{
+	// About five seconds end to end: a few latency probes and two short,
+	// time-bounded transfer phases.
+	"quick": func() Config {
+		c := DefaultConfig()
+		c.PhaseDuration = 2 * time.Second
+		c.LatencyProbes = 5
+		c.SetupProbes = 2
+		c.LatencyInterval = 200 * time.Millisecond
+		return c
+	},
+	"standard": DefaultConfig,
+	// Long phases that keep the link saturated for their full length, more
+	// connections, dense latency probing and a bidirectional phase, for
+	// bufferbloat that only builds up under sustained load.
+	"thorough": func() Config {
+		c := DefaultConfig()
+		c.PhaseDuration = 20 * time.Second
+		c.FullDuration = true
+		c.Bidirectional = true
+		c.MaxConnections = 32
+		c.LatencyProbes = 50
+		c.SetupProbes = 10
+		c.LatencyInterval = 200 * time.Millisecond
+		return c
+	},
+	// Idle latency, jitter and the connection setup breakdown only.
+	"latency-only": func() Config {
+		c := DefaultConfig()
+		c.LatencyProbes = 50
+		c.SetupProbes = 10
+		c.NoDownload = true
+		c.NoUpload = true
+		return c
+	},
+}
+
+// ProfileConfig returns the configuration of the named built-in profile.
+func ProfileConfig(name string) (Config, bool) {
+	newConfig, ok := profiles[name]
+	if !ok {
+		return Config{}, false
+	}
+	return newConfig(), true
+}
+
+// ProfileNames returns the names of the built-in profiles, sorted.
+func ProfileNames() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,75 @@
+package speedtest
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// responsivenessTrim is the percentile above which probe latencies are
+// discarded before averaging, per the IETF responsiveness draft.
+const responsivenessTrim = 0.95
+
+// measureForeignProbes runs probes on fresh connections in the background at
+// the given interval. These are the "foreign" probes of the IETF
+// responsiveness test: each one pays for DNS, TCP and TLS setup while the
+// link is loaded. Returns a cancel function and a channel that receives the
+// samples when cancelled.
+func measureForeignProbes(ctx context.Context, client *http.Client, backend Backend, interval time.Duration) (cancel func(), resultCh <-chan []LatencySample) {
+	ctx, cancelFn := context.WithCancel(ctx)
+	ch := make(chan []LatencySample, 1)
+
+	go func() {
+		var probes []LatencySample
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				ch <- probes
+				return
+			case <-ticker.C:
+				s, reused, err := traceProbe(ctx, client, backend.LatencyURL())
+				if err != nil || reused {
+					continue
+				}
+				probes = append(probes, s)
+			}
+		}
+	}()
+
+	return cancelFn, ch
+}
+
+// computeResponsiveness combines foreign probes with latency samples taken on
+// the load-generating connections ("self" probes) into an RPM score. Returns
+// nil if either set is empty.
+func computeResponsiveness(foreign []LatencySample, self []LatencySample) *Responsiveness {
+	if len(foreign) == 0 || len(self) == 0 {
+		return nil
+	}
+
+	tcp := make([]float64, len(foreign))
+	tlsTimes := make([]float64, len(foreign))
+	httpForeign := make([]float64, len(foreign))
+	for i, p := range foreign {
+		tcp[i] = p.Connect
+		tlsTimes[i] = p.TLS
+		httpForeign[i] = p.TTFB
+	}
+	httpSelf := make([]float64, len(self))
+	for i, s := range self {
+		httpSelf[i] = s.RTT
+	}
+
+	r := &Responsiveness{
+		TCP:         TrimmedMean(tcp, responsivenessTrim),
+		TLS:         TrimmedMean(tlsTimes, responsivenessTrim),
+		HTTPForeign: TrimmedMean(httpForeign, responsivenessTrim),
+		HTTPSelf:    TrimmedMean(httpSelf, responsivenessTrim),
+		Probes:      len(foreign),
+	}
+	r.RPM = RPM(r.TCP, r.TLS, r.HTTPForeign, r.HTTPSelf)
+	return r
+}
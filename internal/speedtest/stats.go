@@ -1,8 +1,10 @@
 package speedtest
 
 import (
+	"fmt"
 	"math"
 	"sort"
+	"strings"
 )
 
 // Percentile computes the p-th percentile (0..1) of a float64 slice.
@@ -39,6 +41,33 @@ func Median(data []float64) float64 {
 	return Percentile(data, 0.50)
 }
 
+// TrimmedMean returns the mean of data after discarding values above the
+// p-th percentile (0..1).
+func TrimmedMean(data []float64, p float64) float64 {
+	if len(data) == 0 {
+		return 0
+	}
+	cutoff := Percentile(data, p)
+	var kept []float64
+	for _, v := range data {
+		if v <= cutoff {
+			kept = append(kept, v)
+		}
+	}
+	return mean(kept)
+}
+
+// RPM computes round-trips per minute from trimmed-mean latencies in ms, per
+// the IETF responsiveness draft:
+// 60000 / (1/6·(TCP + TLS + HTTP_foreign) + 1/2·HTTP_self).
+func RPM(tcp, tls, httpForeign, httpSelf float64) float64 {
+	denom := (tcp+tls+httpForeign)/6 + httpSelf/2
+	if denom <= 0 {
+		return 0
+	}
+	return 60000 / denom
+}
+
 // Jitter computes the standard deviation of a float64 slice (used as jitter measure).
 func Jitter(data []float64) float64 {
 	if len(data) < 2 {
@@ -54,6 +83,32 @@ func Jitter(data []float64) float64 {
 	return math.Sqrt(sumSq / float64(len(data)))
 }
 
+// ThroughputStable reports whether the last three windows of samples (each
+// window samples long) have mean speeds within tolerance (e.g. 0.05 for 5%)
+// of each other. It returns false until there are enough samples.
+func ThroughputStable(samples []Sample, window int, tolerance float64) bool {
+	if window < 1 || len(samples) < 3*window {
+		return false
+	}
+
+	lo, hi := math.Inf(1), math.Inf(-1)
+	tail := samples[len(samples)-3*window:]
+	for i := 0; i < 3; i++ {
+		vals := make([]float64, window)
+		for j, s := range tail[i*window : (i+1)*window] {
+			vals[j] = s.Mbps
+		}
+		m := mean(vals)
+		lo = math.Min(lo, m)
+		hi = math.Max(hi, m)
+	}
+
+	if lo <= 0 {
+		return false
+	}
+	return (hi-lo)/lo <= tolerance
+}
+
 // BufferbloatGrading returns the bufferbloat grade based on the increase in latency
 // under load (loaded median - idle median, in ms).
 func BufferbloatGrading(idleLatency, loadedLatency *LatencyResult) BufferbloatGrade {
@@ -101,10 +156,64 @@ func gradeFromDelta(delta float64) BufferbloatGrade {
 	}
 }
 
-// ContextLine generates a human-readable summary based on test results.
+// GradeFromScore returns the grade nearest to score on the scale used by
+// BufferbloatGrade.Score.
+func GradeFromScore(score float64) BufferbloatGrade {
+	switch int(math.Round(score)) {
+	case 5:
+		return GradeAPlus
+	case 4:
+		return GradeA
+	case 3:
+		return GradeB
+	case 2:
+		return GradeC
+	case 1:
+		return GradeD
+	default:
+		if score > 5 {
+			return GradeAPlus
+		}
+		return GradeF
+	}
+}
+
+// Headline summarizes a result on one line, as printed by --simple:
+// download and upload speed, idle latency and the bufferbloat grade, plus
+// the bidirectional grade if that phase ran. Phases that were skipped are
+// left out.
+func Headline(r *Result) string {
+	var parts []string
+	if r.Download != nil {
+		parts = append(parts, fmt.Sprintf("↓ %.1f Mbps", r.Download.Mbps))
+	}
+	if r.Upload != nil {
+		parts = append(parts, fmt.Sprintf("↑ %.1f Mbps", r.Upload.Mbps))
+	}
+	parts = append(parts, fmt.Sprintf("⏱ %.1fms", r.IdleLatency.Avg))
+	switch {
+	case r.BufferbloatDL != "":
+		parts = append(parts, "Bloat: "+string(r.BufferbloatDL))
+	case r.BufferbloatUL != "":
+		parts = append(parts, "Bloat: "+string(r.BufferbloatUL))
+	}
+	if r.BufferbloatBidir != "" {
+		parts = append(parts, "⇅ "+string(r.BufferbloatBidir))
+	}
+	return strings.Join(parts, "  ")
+}
+
+// ContextLine generates a human-readable summary based on test results. It
+// needs a download result; without one it returns "".
 func ContextLine(result *Result) string {
+	if result.Download == nil {
+		return ""
+	}
 	dl := result.Download.Mbps
-	ul := result.Upload.Mbps
+	var ul float64
+	if result.Upload != nil {
+		ul = result.Upload.Mbps
+	}
 	grade := result.BufferbloatDL
 
 	switch {
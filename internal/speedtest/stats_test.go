@@ -61,6 +61,70 @@ func TestJitter(t *testing.T) {
 	}
 }
 
+func TestTrimmedMean(t *testing.T) {
+	data := []float64{10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 1000}
+	if got := TrimmedMean(data, 0.95); got != 10 {
+		t.Errorf("TrimmedMean = %v, want 10 (outlier trimmed)", got)
+	}
+	if got := TrimmedMean(nil, 0.95); got != 0 {
+		t.Errorf("TrimmedMean(nil) = %v, want 0", got)
+	}
+}
+
+func TestRPM(t *testing.T) {
+	tests := []struct {
+		name                         string
+		tcp, tls, httpF, httpS, want float64
+	}{
+		{"zero", 0, 0, 0, 0, 0},
+		// (20+30+10)/6 + 40/2 = 30ms per round trip -> 2000 RPM
+		{"typical", 20, 30, 10, 40, 2000},
+		// 6/6 + 0 = 1ms -> 60000 RPM
+		{"foreign_only", 2, 2, 2, 0, 60000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := RPM(tt.tcp, tt.tls, tt.httpF, tt.httpS)
+			if math.Abs(got-tt.want) > 0.01 {
+				t.Errorf("RPM() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestThroughputStable(t *testing.T) {
+	makeSamples := func(mbps ...float64) []Sample {
+		samples := make([]Sample, len(mbps))
+		for i, v := range mbps {
+			samples[i] = Sample{Mbps: v}
+		}
+		return samples
+	}
+
+	tests := []struct {
+		name    string
+		samples []Sample
+		window  int
+		want    bool
+	}{
+		{"too_few", makeSamples(100, 100, 100, 100, 100), 2, false},
+		{"flat", makeSamples(100, 101, 99, 100, 100, 101), 2, true},
+		{"ramping", makeSamples(10, 20, 40, 60, 80, 100), 2, false},
+		{"ramp_then_flat", makeSamples(10, 20, 98, 100, 101, 99, 100, 100), 2, true},
+		{"zero", makeSamples(0, 0, 0, 0, 0, 0), 2, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ThroughputStable(tt.samples, tt.window, 0.05)
+			if got != tt.want {
+				t.Errorf("ThroughputStable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestBufferbloatGrading(t *testing.T) {
 	makeLatency := func(rtts ...float64) *LatencyResult {
 		samples := make([]LatencySample, len(rtts))
@@ -96,14 +160,50 @@ func TestBufferbloatGrading(t *testing.T) {
 	}
 }
 
+func TestGradeFromScore(t *testing.T) {
+	tests := []struct {
+		score float64
+		want  BufferbloatGrade
+	}{
+		{5, GradeAPlus},
+		{6, GradeAPlus},
+		{4.4, GradeA},
+		{3.5, GradeA},
+		{3, GradeB},
+		{2.2, GradeC},
+		{1, GradeD},
+		{0.4, GradeF},
+		{-1, GradeF},
+	}
+	for _, tt := range tests {
+		if got := GradeFromScore(tt.score); got != tt.want {
+			t.Errorf("GradeFromScore(%v) = %q, want %q", tt.score, got, tt.want)
+		}
+	}
+	for _, g := range []BufferbloatGrade{GradeAPlus, GradeA, GradeB, GradeC, GradeD, GradeF} {
+		if got := GradeFromScore(float64(g.Score())); got != g {
+			t.Errorf("GradeFromScore(%q.Score()) = %q", g, got)
+		}
+	}
+}
+
 func TestContextLine(t *testing.T) {
 	r := &Result{
-		Download:    PhaseResult{Mbps: 200},
-		Upload:      PhaseResult{Mbps: 50},
+		Download:    &PhaseResult{Mbps: 200},
+		Upload:      &PhaseResult{Mbps: 50},
 		BufferbloatDL: GradeA,
 	}
 	line := ContextLine(r)
 	if line == "" {
 		t.Error("ContextLine returned empty string")
 	}
+
+	r.Upload = nil
+	if line := ContextLine(r); line == "" {
+		t.Error("ContextLine returned empty string without an upload result")
+	}
+	r.Download = nil
+	if line := ContextLine(r); line != "" {
+		t.Errorf("ContextLine() = %q without a download result, want empty", line)
+	}
 }
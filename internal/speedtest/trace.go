@@ -0,0 +1,130 @@
+package speedtest
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// traceProbe performs a GET of url and returns a latency sample broken down
+// by stage with net/http/httptrace. Stages that did not happen, such as DNS
+// and TCP on a reused connection, are zero; reused reports whether the
+// request went over an existing connection.
+func traceProbe(ctx context.Context, client *http.Client, url string) (LatencySample, bool, error) {
+	// The callbacks may run on transport goroutines that outlive the
+	// request, such as a dial that completes after client.Do gives up, so
+	// they only touch these, under mu
+	var (
+		mu                                   sync.Mutex
+		dnsStart, connStart, tlsStart, wrote time.Time
+		stages                               struct{ dns, connect, tls, ttfb float64 }
+		reused                               bool
+	)
+	since := func(start time.Time) float64 {
+		return time.Since(start).Seconds() * 1000
+	}
+
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			mu.Lock()
+			dnsStart = time.Now()
+			mu.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			mu.Lock()
+			stages.dns = since(dnsStart)
+			mu.Unlock()
+		},
+		ConnectStart: func(network, addr string) {
+			mu.Lock()
+			if connStart.IsZero() {
+				connStart = time.Now()
+			}
+			mu.Unlock()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			mu.Lock()
+			if err == nil && stages.connect == 0 {
+				stages.connect = since(connStart)
+			}
+			mu.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			mu.Lock()
+			tlsStart = time.Now()
+			mu.Unlock()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			mu.Lock()
+			stages.tls = since(tlsStart)
+			mu.Unlock()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			mu.Lock()
+			reused = info.Reused
+			mu.Unlock()
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			mu.Lock()
+			wrote = time.Now()
+			mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			mu.Lock()
+			stages.ttfb = since(wrote)
+			mu.Unlock()
+		},
+	}
+
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), http.MethodGet, url, nil)
+	if err != nil {
+		return LatencySample{}, false, err
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return LatencySample{}, false, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	elapsed := since(start)
+
+	mu.Lock()
+	defer mu.Unlock()
+	s := LatencySample{
+		Timestamp: time.Now(),
+		DNS:       stages.dns,
+		Connect:   stages.connect,
+		TLS:       stages.tls,
+		TTFB:      stages.ttfb,
+	}
+	serverTime := parseServerTiming(resp.Header.Get("Server-Timing"))
+	s.RTT = elapsed - serverTime
+	if s.RTT < 0 {
+		s.RTT = elapsed
+	}
+	if serverTime < s.TTFB {
+		s.TTFB -= serverTime
+	}
+	return s, reused, nil
+}
+
+// freshConnClient returns a client with base's transport settings that opens
+// a new connection for every request.
+func freshConnClient(base *http.Client) *http.Client {
+	transport, ok := base.Transport.(*http.Transport)
+	if !ok {
+		transport = http.DefaultTransport.(*http.Transport)
+	}
+	transport = transport.Clone()
+	transport.DisableKeepAlives = true
+	return &http.Client{
+		Transport: transport,
+		Timeout:   base.Timeout,
+	}
+}
@@ -0,0 +1,289 @@
+package speedtest
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Transfer size bounds for timed phases.
+const (
+	timedMinBytes         = 100_000
+	timedMaxDownloadBytes = 100_000_000
+	timedMaxUploadBytes   = 25_000_000
+
+	// timedTransferTarget is how long each timed-mode transfer should take
+	// at the currently measured per-connection throughput.
+	timedTransferTarget = 500 * time.Millisecond
+
+	// connGrowthThreshold is the throughput improvement a window must show
+	// over the best so far for more connections to be added.
+	connGrowthThreshold = 0.10
+
+	// connSaturationStrikes is how many consecutive windows without
+	// improvement mark the connection count as saturated.
+	connSaturationStrikes = 2
+
+	// warmupDuration is the leading stretch of samples ignored when
+	// computing results, while TCP ramps up.
+	warmupDuration = 2 * time.Second
+)
+
+// transferPlan chooses the size of each transfer in a phase. With a fixed
+// sequence it replays the configured sizes; in timed mode it keeps issuing
+// transfers until the deadline, growing them as throughput rises.
+type transferPlan struct {
+	sizes []int // sequence mode
+	next  int
+
+	deadline time.Time // timed mode when non-zero
+	size     int       // current timed-mode size; only ever grows
+	maxBytes int
+}
+
+func newTransferPlan(seq []TransferSpec, duration time.Duration, maxBytes int) *transferPlan {
+	if duration > 0 {
+		return &transferPlan{
+			deadline: time.Now().Add(duration),
+			size:     timedMinBytes,
+			maxBytes: maxBytes,
+		}
+	}
+
+	p := &transferPlan{}
+	for _, spec := range seq {
+		for i := 0; i < spec.Count; i++ {
+			p.sizes = append(p.sizes, spec.Bytes)
+		}
+	}
+	return p
+}
+
+// timed reports whether the plan is deadline-based.
+func (p *transferPlan) timed() bool {
+	return !p.deadline.IsZero()
+}
+
+// Next returns the size of the next transfer given the latest aggregate
+// throughput and connection count, or false when the phase is complete.
+func (p *transferPlan) Next(mbps float64, conns int) (int, bool) {
+	if !p.timed() {
+		if p.next >= len(p.sizes) {
+			return 0, false
+		}
+		p.next++
+		return p.sizes[p.next-1], true
+	}
+
+	if !time.Now().Before(p.deadline) {
+		return 0, false
+	}
+	if conns < 1 {
+		conns = 1
+	}
+	perConn := mbps / float64(conns) * 1e6 / 8 // bytes per second
+	want := int(perConn * timedTransferTarget.Seconds())
+	if want > p.size {
+		p.size = min(want, p.maxBytes)
+	}
+	return p.size, true
+}
+
+// connScaler grows the number of concurrent transfers while aggregate
+// throughput keeps improving, then holds at the saturation point. Slots in
+// sem beyond the current limit are held by the scaler itself and released to
+// workers one by one as it grows.
+type connScaler struct {
+	sem      chan struct{}
+	reserved int // slots held back from workers
+	current  atomic.Int32
+
+	window    int // samples per evaluation
+	evaluated int // sample count at the last evaluation
+	best      float64
+	strikes   int
+}
+
+func newConnScaler(initial, max, window int) *connScaler {
+	if initial <= 0 || initial > max {
+		initial = max
+	}
+	c := &connScaler{
+		sem:      make(chan struct{}, max),
+		reserved: max - initial,
+		window:   window,
+	}
+	for i := 0; i < c.reserved; i++ {
+		c.sem <- struct{}{}
+	}
+	c.current.Store(int32(initial))
+	return c
+}
+
+// Connections returns the current concurrency limit.
+func (c *connScaler) Connections() int {
+	return int(c.current.Load())
+}
+
+// Observe evaluates the latest window of samples and adds connections if
+// throughput improved. It must be called from a single goroutine.
+func (c *connScaler) Observe(samples []Sample) {
+	if c.reserved == 0 || c.strikes >= connSaturationStrikes || len(samples)-c.evaluated < c.window {
+		return
+	}
+	c.evaluated = len(samples)
+
+	vals := make([]float64, c.window)
+	for i, s := range samples[len(samples)-c.window:] {
+		vals[i] = s.Mbps
+	}
+	m := mean(vals)
+
+	if m <= c.best*(1+connGrowthThreshold) {
+		c.strikes++
+		return
+	}
+	c.best = m
+	c.strikes = 0
+
+	// Double the connection count, up to the configured maximum
+	grow := min(c.Connections(), c.reserved)
+	for i := 0; i < grow; i++ {
+		<-c.sem // never blocks: the reserved slots are in the buffer
+	}
+	c.reserved -= grow
+	c.current.Add(int32(grow))
+}
+
+// runTransfers drives a download or upload phase. It issues transfers of the
+// sizes chosen by plan, starting with cfg.InitialConnections concurrent
+// requests and scaling toward cfg.MaxConnections while throughput improves.
+// It samples the growth of totalBytes every cfg.SampleInterval and reports the
+// P90 throughput once the plan is exhausted. In timed mode the phase also
+// ends early once throughput has stabilized, unless cfg.FullDuration is set.
+func runTransfers(ctx context.Context, cfg Config, plan *transferPlan, totalBytes *atomic.Int64, onSample func(Sample), transfer func(ctx context.Context, size int)) (*PhaseResult, error) {
+	// Evaluate stability and scaling over one-second windows
+	window := max(int(time.Second/cfg.SampleInterval), 1)
+	scaler := newConnScaler(cfg.InitialConnections, cfg.MaxConnections, window)
+	sem := scaler.sem
+
+	// In timed mode, in-flight transfers are cut off when the phase ends.
+	phaseCtx, stopPhase := context.WithCancel(ctx)
+	defer stopPhase()
+	if plan.timed() {
+		var cancel context.CancelFunc
+		phaseCtx, cancel = context.WithDeadline(phaseCtx, plan.deadline)
+		defer cancel()
+	}
+
+	// Sampling goroutine
+	var samples []Sample
+	var latestMbps atomic.Uint64 // math.Float64bits
+	sampleCtx, sampleCancel := context.WithCancel(ctx)
+	sampleDone := make(chan struct{})
+
+	go func() {
+		defer close(sampleDone)
+		ticker := time.NewTicker(cfg.SampleInterval)
+		defer ticker.Stop()
+		lastBytes := int64(0)
+		lastTime := time.Now()
+
+		for {
+			select {
+			case <-sampleCtx.Done():
+				return
+			case <-ticker.C:
+				now := time.Now()
+				currentBytes := totalBytes.Load()
+				deltaBytes := currentBytes - lastBytes
+				deltaSeconds := now.Sub(lastTime).Seconds()
+
+				if deltaSeconds > 0 && deltaBytes > 0 {
+					mbps := float64(deltaBytes*8) / deltaSeconds / 1e6
+					s := Sample{Timestamp: now, Mbps: mbps}
+					samples = append(samples, s)
+					latestMbps.Store(math.Float64bits(mbps))
+					if onSample != nil {
+						onSample(s)
+					}
+
+					scaler.Observe(samples)
+
+					warmedUp := now.Sub(samples[0].Timestamp) >= warmupDuration
+					if plan.timed() && !cfg.FullDuration && warmedUp && ThroughputStable(discardWarmup(samples, warmupDuration), window, 0.05) {
+						stopPhase()
+					}
+				}
+
+				lastBytes = currentBytes
+				lastTime = now
+			}
+		}
+	}()
+
+	// Worker goroutines
+	var wg sync.WaitGroup
+loop:
+	for {
+		size, ok := plan.Next(math.Float64frombits(latestMbps.Load()), scaler.Connections())
+		if !ok {
+			break
+		}
+
+		select {
+		case <-phaseCtx.Done():
+			break loop
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(size int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			transfer(phaseCtx, size)
+		}(size)
+	}
+
+	wg.Wait()
+	sampleCancel()
+	<-sampleDone
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Discard the warmup period of samples
+	filtered := discardWarmup(samples, warmupDuration)
+
+	mbps := 0.0
+	if len(filtered) > 0 {
+		vals := make([]float64, len(filtered))
+		for i, s := range filtered {
+			vals[i] = s.Mbps
+		}
+		mbps = Percentile(vals, 0.90)
+	}
+
+	return &PhaseResult{Mbps: mbps, Connections: scaler.Connections(), Samples: samples}, nil
+}
+
+// discardWarmup removes samples from the first `dur` of the test.
+func discardWarmup(samples []Sample, dur time.Duration) []Sample {
+	if len(samples) == 0 {
+		return samples
+	}
+	cutoff := samples[0].Timestamp.Add(dur)
+	for i, s := range samples {
+		if !s.Timestamp.Before(cutoff) {
+			return samples[i:]
+		}
+	}
+	// If all samples are within warmup, return the last half
+	if len(samples) > 2 {
+		return samples[len(samples)/2:]
+	}
+	return samples
+}
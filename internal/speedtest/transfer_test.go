@@ -0,0 +1,183 @@
+package speedtest
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// observeWindow appends a window of samples at mbps and lets c evaluate it.
+func observeWindow(c *connScaler, samples []Sample, mbps float64) []Sample {
+	for i := 0; i < c.window; i++ {
+		samples = append(samples, Sample{Mbps: mbps})
+	}
+	c.Observe(samples)
+	return samples
+}
+
+func TestConnScalerGrowsWhileThroughputImproves(t *testing.T) {
+	c := newConnScaler(2, 16, 4)
+	if got := c.Connections(); got != 2 || len(c.sem) != 14 {
+		t.Fatalf("start: %d connections, %d slots held back; want 2 and 14", got, len(c.sem))
+	}
+
+	var samples []Sample
+	for _, step := range []struct {
+		mbps float64
+		want int
+	}{
+		{100, 4},  // first window always improves on nothing
+		{200, 8},  // doubled
+		{205, 8},  // under the growth threshold: one strike
+		{300, 16}, // improvement resets the strikes; capped at the maximum
+		{600, 16}, // nothing left to add
+	} {
+		samples = observeWindow(c, samples, step.mbps)
+		if got := c.Connections(); got != step.want {
+			t.Errorf("after %v Mbps: %d connections, want %d", step.mbps, got, step.want)
+		}
+		if len(c.sem) != c.reserved || c.reserved != 16-c.Connections() {
+			t.Errorf("after %v Mbps: %d slots held back, reserved %d", step.mbps, len(c.sem), c.reserved)
+		}
+	}
+}
+
+func TestConnScalerStopsWhenSaturated(t *testing.T) {
+	c := newConnScaler(1, 32, 2)
+	var samples []Sample
+	samples = observeWindow(c, samples, 100) // 2
+	samples = observeWindow(c, samples, 105)
+	samples = observeWindow(c, samples, 100)
+	samples = observeWindow(c, samples, 1000) // saturated already: ignored
+	if got := c.Connections(); got != 2 {
+		t.Errorf("%d connections, want 2 after %d windows without improvement", got, connSaturationStrikes)
+	}
+}
+
+func TestConnScalerWaitsForFullWindow(t *testing.T) {
+	c := newConnScaler(2, 8, 5)
+	samples := []Sample{{Mbps: 100}, {Mbps: 100}, {Mbps: 100}}
+	c.Observe(samples)
+	if got := c.Connections(); got != 2 {
+		t.Errorf("%d connections after a partial window, want 2", got)
+	}
+}
+
+func TestConnScalerInitialDefaults(t *testing.T) {
+	for _, tt := range []struct {
+		initial, max, want int
+	}{
+		{0, 16, 16},  // unset: start at the maximum
+		{-1, 16, 16}, // likewise
+		{32, 16, 16}, // clamped to the maximum
+		{4, 16, 4},
+	} {
+		c := newConnScaler(tt.initial, tt.max, 1)
+		if got := c.Connections(); got != tt.want || len(c.sem) != tt.max-tt.want {
+			t.Errorf("newConnScaler(%d, %d): %d connections, %d held back; want %d",
+				tt.initial, tt.max, got, len(c.sem), tt.want)
+		}
+	}
+}
+
+func TestTransferPlanSequence(t *testing.T) {
+	p := newTransferPlan([]TransferSpec{{Bytes: 100, Count: 2}, {Bytes: 1000, Count: 1}}, 0, 0)
+	if p.timed() {
+		t.Fatal("plan with a sequence and no duration is timed")
+	}
+	var got []int
+	for {
+		// Throughput doesn't change a sequence
+		size, ok := p.Next(1000, 4)
+		if !ok {
+			break
+		}
+		got = append(got, size)
+	}
+	if len(got) != 3 || got[0] != 100 || got[1] != 100 || got[2] != 1000 {
+		t.Errorf("sizes = %v, want [100 100 1000]", got)
+	}
+}
+
+func TestTransferPlanTimed(t *testing.T) {
+	p := newTransferPlan([]TransferSpec{{Bytes: 100, Count: 2}}, time.Minute, 10_000_000)
+	if !p.timed() {
+		t.Fatal("plan with a duration isn't timed")
+	}
+	for _, step := range []struct {
+		mbps  float64
+		conns int
+		want  int
+	}{
+		{0, 4, timedMinBytes}, // nothing measured yet
+		{4, 4, timedMinBytes}, // 1 Mbps a connection: 62.5 KB in 500ms is under the minimum
+		{80, 4, 1_250_000},    // 20 Mbps a connection fills 500ms with 1.25 MB
+		{8, 4, 1_250_000},     // never shrinks
+		{80, 0, 5_000_000},    // no connections counts as one
+		{8000, 4, 10_000_000}, // capped at maxBytes
+	} {
+		size, ok := p.Next(step.mbps, step.conns)
+		if !ok || size != step.want {
+			t.Errorf("Next(%v, %d) = %d, %v; want %d", step.mbps, step.conns, size, ok, step.want)
+		}
+	}
+
+	p.deadline = time.Now()
+	if size, ok := p.Next(80, 4); ok {
+		t.Errorf("Next() after the deadline = %d, want the phase over", size)
+	}
+}
+
+// steadyTransfer returns a transfer that adds to total at mbps, shared by
+// however many transfers run at once, until size bytes or ctx is done.
+func steadyTransfer(total *atomic.Int64, mbps float64) func(context.Context, int) {
+	return func(ctx context.Context, size int) {
+		last := time.Now()
+		for sent := 0; sent < size && ctx.Err() == nil; {
+			time.Sleep(time.Millisecond)
+			now := time.Now()
+			n := int(now.Sub(last).Seconds() * mbps * 1e6 / 8)
+			last = now
+			total.Add(int64(n))
+			sent += n
+		}
+	}
+}
+
+func TestRunTransfersTimed(t *testing.T) {
+	cfg := Config{InitialConnections: 1, MaxConnections: 1, SampleInterval: 100 * time.Millisecond}
+
+	t.Run("stops at the deadline", func(t *testing.T) {
+		var total atomic.Int64
+		start := time.Now()
+		plan := newTransferPlan(nil, 300*time.Millisecond, timedMaxDownloadBytes)
+		// A single huge transfer must be cut off rather than run to the end
+		plan.size = timedMaxDownloadBytes
+		cfg := cfg
+		cfg.FullDuration = true
+		if _, err := runTransfers(context.Background(), cfg, plan, &total, nil, steadyTransfer(&total, 100)); err != nil {
+			t.Fatal(err)
+		}
+		if took := time.Since(start); took < 300*time.Millisecond || took > time.Second {
+			t.Errorf("phase took %v, want it to end at the 300ms deadline", took)
+		}
+	})
+
+	t.Run("stops once stable", func(t *testing.T) {
+		var total atomic.Int64
+		start := time.Now()
+		plan := newTransferPlan(nil, 30*time.Second, timedMaxDownloadBytes)
+		result, err := runTransfers(context.Background(), cfg, plan, &total, nil, steadyTransfer(&total, 100))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Warmup plus three stable one-second windows
+		if took := time.Since(start); took > 10*time.Second {
+			t.Errorf("phase took %v, want it to end once throughput stabilized", took)
+		}
+		if result.Mbps < 90 || result.Mbps > 110 {
+			t.Errorf("throughput = %.1f Mbps, want about 100", result.Mbps)
+		}
+	})
+}
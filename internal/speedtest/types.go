@@ -1,6 +1,10 @@
 package speedtest
 
-import "time"
+import (
+	"context"
+	"errors"
+	"time"
+)
 
 // Phase represents a stage of the speed test.
 type Phase int
@@ -10,6 +14,7 @@ const (
 	PhaseLatency
 	PhaseDownload
 	PhaseUpload
+	PhaseBidirectional
 	PhaseDone
 )
 
@@ -23,6 +28,8 @@ func (p Phase) String() string {
 		return "download"
 	case PhaseUpload:
 		return "upload"
+	case PhaseBidirectional:
+		return "bidirectional"
 	case PhaseDone:
 		return "done"
 	default:
@@ -39,22 +46,68 @@ type Sample struct {
 // LatencySample is a single latency measurement.
 type LatencySample struct {
 	Timestamp time.Time `json:"timestamp"`
-	RTT       float64   `json:"rtt_ms"` // round-trip time in milliseconds
+	RTT       float64   `json:"rtt_ms"`               // round-trip time in milliseconds
+	DNS       float64   `json:"dns_ms,omitempty"`     // DNS lookup, if one was needed
+	Connect   float64   `json:"connect_ms,omitempty"` // TCP connect, on a new connection
+	TLS       float64   `json:"tls_ms,omitempty"`     // TLS handshake, on a new connection
+	TTFB      float64   `json:"ttfb_ms,omitempty"`    // request sent to first response byte, minus server time
 }
 
 // PhaseResult holds the outcome of a download or upload phase.
 type PhaseResult struct {
-	Mbps    float64  `json:"mbps"`    // P90 speed
-	Samples []Sample `json:"samples"` // all raw samples
+	Mbps        float64  `json:"mbps"`        // P90 speed
+	Connections int      `json:"connections"` // parallel connections at saturation
+	Samples     []Sample `json:"samples"`     // all raw samples
 }
 
 // LatencyResult holds latency measurement outcomes.
 type LatencyResult struct {
-	Min     float64         `json:"min_ms"`
-	Max     float64         `json:"max_ms"`
-	Avg     float64         `json:"avg_ms"`
-	Jitter  float64         `json:"jitter_ms"`
-	Samples []LatencySample `json:"samples"`
+	Min       float64           `json:"min_ms"`
+	Max       float64           `json:"max_ms"`
+	Avg       float64           `json:"avg_ms"`
+	Jitter    float64           `json:"jitter_ms"`
+	Loss      *PacketLoss       `json:"packet_loss,omitempty"` // nil unless a UDP echo server was configured
+	Breakdown *LatencyBreakdown `json:"breakdown,omitempty"`
+	Samples   []LatencySample   `json:"samples"`
+}
+
+// LatencyBreakdown splits probe latency into its stages so a slow result can
+// be traced to the resolver, the connection setup or the path itself.
+type LatencyBreakdown struct {
+	DNS     StageStats `json:"dns"`
+	Connect StageStats `json:"connect"`
+	TLS     StageStats `json:"tls"`
+	TTFB    StageStats `json:"ttfb"`
+}
+
+// StageStats summarizes one stage across the probes in which it occurred, in
+// milliseconds. Count is zero if the stage never happened, e.g. DNS when
+// every probe reused a connection.
+type StageStats struct {
+	Avg   float64 `json:"avg_ms"`
+	Min   float64 `json:"min_ms"`
+	Max   float64 `json:"max_ms"`
+	Count int     `json:"count"`
+}
+
+// PacketLoss holds the outcome of a UDP echo packet loss probe.
+type PacketLoss struct {
+	Sent       int     `json:"sent"`
+	Received   int     `json:"received"`
+	Reordered  int     `json:"reordered"`
+	LossPct    float64 `json:"loss_pct"`
+	ReorderPct float64 `json:"reorder_pct"`
+}
+
+// Responsiveness is the IETF "Round-trips Per Minute" measurement taken under
+// load. Stage latencies are trimmed means in milliseconds.
+type Responsiveness struct {
+	RPM         float64 `json:"rpm"`
+	TCP         float64 `json:"tcp_ms"`          // TCP handshake on fresh connections
+	TLS         float64 `json:"tls_ms"`          // TLS handshake on fresh connections
+	HTTPForeign float64 `json:"http_foreign_ms"` // request round trip on fresh connections
+	HTTPSelf    float64 `json:"http_self_ms"`    // request round trip on load-generating connections
+	Probes      int     `json:"probes"`          // fresh-connection probes taken
 }
 
 // ServerInfo holds metadata about the test server / client.
@@ -63,6 +116,10 @@ type ServerInfo struct {
 	Colo     string `json:"colo"`      // IATA airport code
 	ColoCity string `json:"colo_city"` // human-readable city name
 	Location string `json:"location"`  // country code
+
+	// AddressFamily is the IP version the test ran over, as seen by the
+	// server.
+	AddressFamily AddressFamily `json:"address_family,omitempty"`
 }
 
 // BufferbloatGrade represents the quality grade for bufferbloat.
@@ -77,18 +134,92 @@ const (
 	GradeF     BufferbloatGrade = "F"
 )
 
-// Result is the complete outcome of a speed test run.
+// Score maps a grade onto 5 (A+) through 0 (F) so grades can be averaged and
+// compared. Unknown or empty grades score -1.
+func (g BufferbloatGrade) Score() int {
+	switch g {
+	case GradeAPlus:
+		return 5
+	case GradeA:
+		return 4
+	case GradeB:
+		return 3
+	case GradeC:
+		return 2
+	case GradeD:
+		return 1
+	case GradeF:
+		return 0
+	default:
+		return -1
+	}
+}
+
+// RunStatus records how a run ended.
+type RunStatus string
+
+const (
+	StatusOK              RunStatus = "ok"
+	StatusPreflightFailed RunStatus = "preflight_failed"
+	StatusError           RunStatus = "error"
+	StatusCancelled       RunStatus = "cancelled"
+)
+
+// OK reports whether the run completed. Entries saved before statuses were
+// recorded have an empty status and count as completed.
+func (s RunStatus) OK() bool {
+	return s == StatusOK || s == ""
+}
+
+// CheckOutcome is a preflight check as recorded with a failed run.
+type CheckOutcome struct {
+	Name    string  `json:"name"`
+	Passed  bool    `json:"passed"`
+	Detail  string  `json:"detail,omitempty"`
+	Latency float64 `json:"latency_ms,omitempty"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// Result is the complete outcome of a speed test run. Runs that did not
+// complete carry only a timestamp, status, and the error or failing
+// preflight checks. The download and upload fields are nil when their phase
+// was skipped (see Config.NoDownload and NoUpload), and the Bidir fields
+// unless the bidirectional phase ran (see Config.Bidirectional).
 type Result struct {
 	Timestamp       time.Time        `json:"timestamp"`
+	Status          RunStatus        `json:"status,omitempty"`
+	Error           string           `json:"error,omitempty"`
+	Preflight       []CheckOutcome   `json:"preflight,omitempty"`
 	Server          ServerInfo       `json:"server"`
-	Download        PhaseResult      `json:"download"`
-	Upload          PhaseResult      `json:"upload"`
+	Download        *PhaseResult     `json:"download,omitempty"`
+	Upload          *PhaseResult     `json:"upload,omitempty"`
 	IdleLatency     LatencyResult    `json:"idle_latency"`
-	DownloadLatency LatencyResult    `json:"download_latency"`
-	UploadLatency   LatencyResult    `json:"upload_latency"`
-	BufferbloatDL   BufferbloatGrade `json:"bufferbloat_download"`
-	BufferbloatUL   BufferbloatGrade `json:"bufferbloat_upload"`
-	ContextLine     string           `json:"context_line"`
+	DownloadLatency *LatencyResult   `json:"download_latency,omitempty"`
+	UploadLatency   *LatencyResult   `json:"upload_latency,omitempty"`
+	BufferbloatDL   BufferbloatGrade `json:"bufferbloat_download,omitempty"`
+	BufferbloatUL   BufferbloatGrade `json:"bufferbloat_upload,omitempty"`
+	Responsiveness  *Responsiveness  `json:"responsiveness,omitempty"`
+	ContextLine     string           `json:"context_line,omitempty"`
+
+	// Download and upload measured at the same time, as during a video call
+	BidirDownload    *PhaseResult     `json:"bidir_download,omitempty"`
+	BidirUpload      *PhaseResult     `json:"bidir_upload,omitempty"`
+	BidirLatency     *LatencyResult   `json:"bidir_latency,omitempty"`
+	BufferbloatBidir BufferbloatGrade `json:"bufferbloat_bidir,omitempty"`
+}
+
+// FailedResult returns the history entry for a run that stopped with err:
+// cancelled if the run's context was cancelled, an error otherwise.
+func FailedResult(err error) *Result {
+	status := StatusError
+	if errors.Is(err, context.Canceled) {
+		status = StatusCancelled
+	}
+	return &Result{
+		Timestamp: time.Now(),
+		Status:    status,
+		Error:     err.Error(),
+	}
 }
 
 // ProgressCallback receives updates as the test progresses.
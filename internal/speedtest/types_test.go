@@ -0,0 +1,36 @@
+package speedtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestFailedResult(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want RunStatus
+	}{
+		{"error", errors.New("connection reset"), StatusError},
+		{"cancelled", context.Canceled, StatusCancelled},
+		{"wrapped cancel", fmt.Errorf("download: %w", context.Canceled), StatusCancelled},
+		{"timeout", context.DeadlineExceeded, StatusError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := FailedResult(tt.err)
+			if r.Status != tt.want || r.Status.OK() {
+				t.Errorf("status = %q, want %q", r.Status, tt.want)
+			}
+			if r.Error != tt.err.Error() {
+				t.Errorf("error = %q, want %q", r.Error, tt.err)
+			}
+			if r.Timestamp.IsZero() || r.Download != nil || r.Upload != nil {
+				t.Errorf("result = %+v, want a timestamped result without phases", r)
+			}
+		})
+	}
+}
@@ -1,14 +1,12 @@
 package speedtest
 
 import (
-	"bytes"
 	"context"
 	"crypto/rand"
 	"fmt"
 	"io"
 	"net/http"
 	"sync/atomic"
-	"time"
 )
 
 // countingReader wraps a reader and counts bytes read, adding them to an atomic counter.
@@ -25,10 +23,32 @@ func (c *countingReader) Read(p []byte) (int, error) {
 	return n, err
 }
 
-// MeasureUpload measures upload speed using the configured sequence.
-func MeasureUpload(ctx context.Context, client *http.Client, cfg Config, measID string, onSample func(Sample)) (*PhaseResult, error) {
+// repeatReader yields remaining bytes by cycling through buf, so large
+// uploads don't need a buffer of their full size.
+type repeatReader struct {
+	buf       []byte
+	off       int
+	remaining int
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if len(p) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n := copy(p, r.buf[r.off:])
+	r.off = (r.off + n) % len(r.buf)
+	r.remaining -= n
+	return n, nil
+}
+
+// MeasureUpload measures upload speed using the configured sequence, or for
+// cfg.PhaseDuration when set.
+func MeasureUpload(ctx context.Context, client *http.Client, backend Backend, cfg Config, measID string, onSample func(Sample)) (*PhaseResult, error) {
 	var totalBytes atomic.Int64
-	sem := make(chan struct{}, cfg.MaxConnections)
+	plan := newTransferPlan(cfg.UploadSequence, cfg.PhaseDuration, timedMaxUploadBytes)
 
 	// Pre-generate a 1MB random buffer to reuse
 	randomBuf := make([]byte, 1_000_000)
@@ -36,125 +56,24 @@ func MeasureUpload(ctx context.Context, client *http.Client, cfg Config, measID
 		return nil, fmt.Errorf("generating random data: %w", err)
 	}
 
-	type job struct {
-		bytes int
-	}
-	var jobs []job
-	for _, spec := range cfg.UploadSequence {
-		for i := 0; i < spec.Count; i++ {
-			jobs = append(jobs, job{bytes: spec.Bytes})
-		}
-	}
-
-	// Sampling goroutine
-	var samples []Sample
-	sampleCtx, sampleCancel := context.WithCancel(ctx)
-	sampleDone := make(chan struct{})
-
-	go func() {
-		defer close(sampleDone)
-		ticker := time.NewTicker(cfg.SampleInterval)
-		defer ticker.Stop()
-		lastBytes := int64(0)
-		lastTime := time.Now()
-
-		for {
-			select {
-			case <-sampleCtx.Done():
-				return
-			case <-ticker.C:
-				now := time.Now()
-				currentBytes := totalBytes.Load()
-				deltaBytes := currentBytes - lastBytes
-				deltaSeconds := now.Sub(lastTime).Seconds()
-
-				if deltaSeconds > 0 && deltaBytes > 0 {
-					mbps := float64(deltaBytes*8) / deltaSeconds / 1e6
-					s := Sample{Timestamp: now, Mbps: mbps}
-					samples = append(samples, s)
-					if onSample != nil {
-						onSample(s)
-					}
-				}
-
-				lastBytes = currentBytes
-				lastTime = now
-			}
+	return runTransfers(ctx, cfg, plan, &totalBytes, onSample, func(ctx context.Context, size int) {
+		reader := &countingReader{
+			reader:  &repeatReader{buf: randomBuf, remaining: size},
+			counter: &totalBytes,
 		}
-	}()
 
-	// Worker goroutines
-	doneCh := make(chan struct{}, len(jobs))
-
-	for _, j := range jobs {
-		select {
-		case <-ctx.Done():
-			sampleCancel()
-			<-sampleDone
-			return nil, ctx.Err()
-		case sem <- struct{}{}:
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, backend.UploadURL(measID), reader)
+		if err != nil {
+			return
 		}
+		req.ContentLength = int64(size)
+		req.Header.Set("Content-Type", "application/octet-stream")
 
-		go func(size int) {
-			defer func() { <-sem }()
-
-			// Build upload body from the random buffer
-			var body []byte
-			if size <= len(randomBuf) {
-				body = randomBuf[:size]
-			} else {
-				body = make([]byte, size)
-				for i := 0; i < size; i += len(randomBuf) {
-					copy(body[i:], randomBuf)
-				}
-			}
-
-			url := baseURL + "/__up"
-			if measID != "" {
-				url += "?measId=" + measID
-			}
-
-			reader := &countingReader{
-				reader:  bytes.NewReader(body),
-				counter: &totalBytes,
-			}
-
-			req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, reader)
-			if err != nil {
-				doneCh <- struct{}{}
-				return
-			}
-			req.ContentLength = int64(size)
-			req.Header.Set("Content-Type", "application/octet-stream")
-
-			resp, err := client.Do(req)
-			if err != nil {
-				doneCh <- struct{}{}
-				return
-			}
-			io.Copy(io.Discard, resp.Body)
-			resp.Body.Close()
-			doneCh <- struct{}{}
-		}(j.bytes)
-	}
-
-	for i := 0; i < len(jobs); i++ {
-		<-doneCh
-	}
-
-	sampleCancel()
-	<-sampleDone
-
-	filtered := discardWarmup(samples, 2*time.Second)
-
-	mbps := 0.0
-	if len(filtered) > 0 {
-		vals := make([]float64, len(filtered))
-		for i, s := range filtered {
-			vals[i] = s.Mbps
+		resp, err := client.Do(req)
+		if err != nil {
+			return
 		}
-		mbps = Percentile(vals, 0.90)
-	}
-
-	return &PhaseResult{Mbps: mbps, Samples: samples}, nil
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	})
 }
@@ -2,7 +2,6 @@ package tui
 
 import (
 	"context"
-	"net/http"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -39,6 +38,8 @@ func (c *tuiCallback) OnPhase(phase speedtest.Phase) {
 		// nothing to send yet
 	case speedtest.PhaseUpload:
 		// nothing to send yet
+	case speedtest.PhaseBidirectional:
+		c.program.Send(bidirStartMsg{})
 	case speedtest.PhaseDone:
 		// nothing to send yet
 	}
@@ -62,10 +63,11 @@ func (c *tuiCallback) OnLoadedLatencySample(s speedtest.LatencySample) {
 
 // runPreflight runs network diagnostic checks, sending individual results
 // via p.Send() and returning preflightCompleteMsg when done.
-func runPreflight(ctx context.Context, pref *programRef) tea.Cmd {
+func runPreflight(ctx context.Context, pref *programRef, engine *speedtest.Engine) tea.Cmd {
 	return func() tea.Msg {
-		client := &http.Client{Timeout: 10 * time.Second}
-		result := preflight.Run(ctx, client, func(r preflight.CheckResult) {
+		client := speedtest.NewHTTPClient(engine.Family)
+		client.Timeout = 10 * time.Second
+		result := preflight.Run(ctx, client, engine.Backend, engine.Family, func(r preflight.CheckResult) {
 			pref.p.Send(preflightCheckMsg{result: r})
 		})
 		return preflightCompleteMsg{result: result}
@@ -35,6 +35,7 @@ func (f Footer) View() string {
 	}{
 		{"r", "Run Again"},
 		{"h", "History"},
+		{"d", "Details"},
 		{"e", "Export JSON"},
 		{"c", "Compare"},
 		{"?", "Help"},
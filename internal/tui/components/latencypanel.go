@@ -19,6 +19,15 @@ type LatencyPanel struct {
 	BBGradeUL      speedtest.BufferbloatGrade
 	BBDeltaDL      float64 // loaded - idle median delta
 	BBDeltaUL      float64
+	LossIdle       float64 // idle packet loss %
+	LossLoaded     float64 // worst packet loss % under load
+	HasLoss        bool    // true when packet loss was measured
+	RPM            float64 // responsiveness under load, 0 if not measured
+	Bidir          bool    // show the bidirectional phase row
+	BBGradeBidir   speedtest.BufferbloatGrade
+	BBDeltaBidir   float64
+	BidirDLMbps    float64
+	BidirULMbps    float64
 	Active         bool
 	Width          int // terminal width — set by parent
 
@@ -158,24 +167,48 @@ func (p LatencyPanel) View() string {
 	// Jitter column
 	jitLabel := p.latencyStyle.Render("〜 Jitter")
 	jitValue := p.boldStyle.Render(fmt.Sprintf("%.1fms", p.Jitter))
+	if p.Done && p.HasLoss {
+		jitValue += p.mutedStyle.Render(fmt.Sprintf(" · %.1f%% → %.1f%% loss", p.LossIdle, p.LossLoaded))
+	}
 	jitSpark := p.jitterSparkline.View()
 	jitCol := colStyle.Render(lipgloss.JoinVertical(lipgloss.Left, jitLabel, jitValue, jitSpark))
 
 	// Bufferbloat column
 	bbLabel := p.latencyStyle.Render("≋ Bufferbloat")
 	var bbValue string
-	if p.Done {
-		bbValue = p.renderGrade(p.BBGradeDL) + "  " + p.mutedStyle.Render(fmt.Sprintf("+%.0fms", p.BBDeltaDL))
-	} else {
+	switch {
+	case !p.Done:
 		bbValue = p.boldStyle.Render("—")
+	case p.BBGradeDL == "" && p.BBGradeUL == "":
+		bbValue = p.mutedStyle.Render("not measured") // no loaded phase ran
+	case p.BBGradeDL == "":
+		bbValue = p.renderGrade(p.BBGradeUL) + "  " + p.mutedStyle.Render(fmt.Sprintf("+%.0fms", p.BBDeltaUL))
+	default:
+		bbValue = p.renderGrade(p.BBGradeDL) + "  " + p.mutedStyle.Render(fmt.Sprintf("+%.0fms", p.BBDeltaDL))
+	}
+	if p.Done && p.RPM > 0 {
+		bbValue += p.mutedStyle.Render(fmt.Sprintf(" · %.0f RPM", p.RPM))
 	}
 	bbSpark := p.bbSparkline.View()
 	bbCol := colStyle.Render(lipgloss.JoinVertical(lipgloss.Left, bbLabel, bbValue, bbSpark))
 
 	panel := lipgloss.JoinHorizontal(lipgloss.Top, latCol, " ", jitCol, " ", bbCol)
+	if p.Bidir {
+		panel = lipgloss.JoinVertical(lipgloss.Left, panel, p.viewBidir())
+	}
 	return lipgloss.NewStyle().PaddingLeft(2).Render(panel)
 }
 
+// viewBidir renders the row for the phase that downloads and uploads at once.
+func (p LatencyPanel) viewBidir() string {
+	label := p.latencyStyle.Render("⇅ Both directions")
+	if !p.Done || p.BBGradeBidir == "" {
+		return label + "  " + p.boldStyle.Render("—")
+	}
+	return label + "  " + p.renderGrade(p.BBGradeBidir) + "  " +
+		p.mutedStyle.Render(fmt.Sprintf("+%.0fms · ↓ %.0f ↑ %.0f Mbps", p.BBDeltaBidir, p.BidirDLMbps, p.BidirULMbps))
+}
+
 func (p LatencyPanel) viewPlaceholder() string {
 	colW := (p.Width - 4) / 3
 	if colW < 12 {
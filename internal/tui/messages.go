@@ -26,6 +26,10 @@ type uploadCompleteMsg struct {
 	grade   speedtest.BufferbloatGrade
 }
 
+// bidirStartMsg marks the start of the phase that downloads and uploads at
+// the same time. It streams no throughput samples, so it's announced.
+type bidirStartMsg struct{}
+
 type testCompleteMsg struct {
 	result *speedtest.Result
 }
@@ -22,12 +22,19 @@ const (
 	stateLatency
 	stateDownload
 	stateUpload
+	stateBidir
 	stateDone
 	stateError
 	stateHistory
 	stateHelp
+	stateDetail
 )
 
+// running reports whether a test is in progress in s.
+func (s state) running() bool {
+	return s >= statePreflight && s <= stateBidir
+}
+
 // programRef is a shared reference that survives model copies.
 type programRef struct {
 	p *tea.Program
@@ -72,8 +79,8 @@ type Model struct {
 	pref *programRef
 }
 
-// NewModel creates a new TUI model.
-func NewModel(themeName string, store *history.Store) Model {
+// NewModel creates a new TUI model that runs tests with engine.
+func NewModel(themeName string, store *history.Store, engine *speedtest.Engine) Model {
 	theme := ThemeFromName(themeName)
 
 	s := spinner.New()
@@ -90,7 +97,7 @@ func NewModel(themeName string, store *history.Store) Model {
 
 	return Model{
 		state:          stateInit,
-		engine:         speedtest.NewEngine(),
+		engine:         engine,
 		store:          store,
 		spinner:        s,
 		header:         header,
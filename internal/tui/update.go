@@ -4,11 +4,13 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/charmbracelet/bubbles/spinner"
 	tea "github.com/charmbracelet/bubbletea"
 
 	"github.com/allenan/brr/internal/export"
+	"github.com/allenan/brr/internal/speedtest"
 )
 
 // Update handles all messages.
@@ -20,6 +22,11 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if m.cancel != nil {
 				m.cancel()
 			}
+			// The test's own error never arrives once we quit, so record
+			// the interrupted run here
+			if m.state.running() && m.store != nil {
+				m.store.Save(speedtest.FailedResult(context.Canceled))
+			}
 			return m, tea.Quit
 		case "h":
 			if m.state == stateDone {
@@ -32,36 +39,40 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 		case "e":
 			if m.state == stateDone && m.result != nil {
-				f, err := os.Create("brr-result.json")
-				if err == nil {
-					export.ToJSON(f, m.result)
-					f.Close()
-					m.statusMsg = "Exported to brr-result.json"
+				name := export.Filename(m.result, "json")
+				if err := exportResult(name, m.result); err != nil {
+					m.statusMsg = fmt.Sprintf("Export failed: %v", err)
+				} else {
+					m.statusMsg = "Exported to " + name
 				}
 				return m, nil
 			}
 		case "c":
 			if m.state == stateDone {
 				// Compare with last run
-				entries, err := m.store.Last(2)
+				entries, err := m.store.LastOK(2)
 				if err == nil && len(entries) >= 2 {
 					prev := entries[1] // entries[0] is the current run we just saved
-					m.statusMsg = fmt.Sprintf("vs last: ↓ %.1f→%.1f  ↑ %.1f→%.1f  ⏱ %.0f→%.0fms",
-						prev.Download.Mbps, m.result.Download.Mbps,
-						prev.Upload.Mbps, m.result.Upload.Mbps,
-						prev.IdleLatency.Avg, m.result.IdleLatency.Avg,
-					)
+					var parts []string
+					if prev.Download != nil && m.result.Download != nil {
+						parts = append(parts, fmt.Sprintf("↓ %.1f→%.1f", prev.Download.Mbps, m.result.Download.Mbps))
+					}
+					if prev.Upload != nil && m.result.Upload != nil {
+						parts = append(parts, fmt.Sprintf("↑ %.1f→%.1f", prev.Upload.Mbps, m.result.Upload.Mbps))
+					}
+					parts = append(parts, fmt.Sprintf("⏱ %.0f→%.0fms", prev.IdleLatency.Avg, m.result.IdleLatency.Avg))
+					m.statusMsg = "vs last: " + strings.Join(parts, "  ")
 				} else {
 					m.statusMsg = "No previous run to compare"
 				}
 				return m, nil
 			}
 		case "r":
-			if m.state == stateDone || m.state == stateHistory || m.state == stateHelp || m.state == stateError {
+			if m.state == stateDone || m.state == stateHistory || m.state == stateHelp || m.state == stateDetail || m.state == stateError {
 				if m.cancel != nil {
 					m.cancel()
 				}
-				fresh := NewModel(m.theme.Name, m.store)
+				fresh := NewModel(m.theme.Name, m.store, m.engine)
 				fresh.width = m.width
 				fresh.height = m.height
 				fresh.pref = m.pref
@@ -72,13 +83,18 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				fresh.latencyPanel.Resize(m.width)
 				return fresh, tea.Batch(fresh.spinner.Tick, animTick())
 			}
+		case "d":
+			if m.state == stateDone && m.result != nil {
+				m.state = stateDetail
+				return m, nil
+			}
 		case "?":
 			if m.state == stateDone {
 				m.state = stateHelp
 				return m, nil
 			}
 		case "esc":
-			if m.state == stateHistory || m.state == stateHelp {
+			if m.state == stateHistory || m.state == stateHelp || m.state == stateDetail {
 				m.state = stateDone
 				return m, nil
 			}
@@ -110,7 +126,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.ctx, m.cancel = context.WithCancel(context.Background())
 			return m, tea.Batch(
 				animTick(),
-				runPreflight(m.ctx, m.pref),
+				runPreflight(m.ctx, m.pref, m.engine),
 			)
 		}
 		return m, animTick()
@@ -129,6 +145,9 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.preflightPanel.SetMessage(msg.result.Message)
 		m.state = stateError
 		m.err = fmt.Errorf("preflight check failed")
+		if m.store != nil {
+			m.store.Save(msg.result.FailedResult())
+		}
 		return m, nil
 
 	// Sample messages
@@ -152,6 +171,11 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.latencyPanel.PushLatency(msg.sample.RTT)
 		return m, nil
 
+	case bidirStartMsg:
+		m.state = stateBidir
+		m.latencyPanel.Bidir = true
+		return m, nil
+
 	case loadedLatencySampleMsg:
 		m.latencyPanel.PushLoadedLatency(msg.sample.RTT)
 		return m, nil
@@ -163,28 +187,51 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.server = msg.result.Server
 
 		// Set final values
-		m.dlGauge.TargetMbps = msg.result.Download.Mbps
-		m.dlGauge.Active = true
-		m.dlGauge.Done = true
-		m.ulGauge.TargetMbps = msg.result.Upload.Mbps
-		m.ulGauge.Active = true
-		m.ulGauge.Done = true
+		if dl := msg.result.Download; dl != nil {
+			m.dlGauge.TargetMbps = dl.Mbps
+			m.dlGauge.Active = true
+			m.dlGauge.Done = true
+		}
+		if ul := msg.result.Upload; ul != nil {
+			m.ulGauge.TargetMbps = ul.Mbps
+			m.ulGauge.Active = true
+			m.ulGauge.Done = true
+		}
 
 		m.latencyPanel.Active = true
 		m.latencyPanel.Done = true
 		m.latencyPanel.IdleLatency = msg.result.IdleLatency.Avg
 		m.latencyPanel.Jitter = msg.result.IdleLatency.Jitter
-		if len(msg.result.DownloadLatency.Samples) > 0 {
-			m.latencyPanel.LoadedLatencyDL = msg.result.DownloadLatency.Avg
+		if l := msg.result.DownloadLatency; l != nil && len(l.Samples) > 0 {
+			m.latencyPanel.LoadedLatencyDL = l.Avg
 		}
 
 		m.latencyPanel.BBGradeDL = msg.result.BufferbloatDL
 		m.latencyPanel.BBGradeUL = msg.result.BufferbloatUL
-		if len(msg.result.DownloadLatency.Samples) > 0 {
-			m.latencyPanel.BBDeltaDL = msg.result.DownloadLatency.Avg - msg.result.IdleLatency.Avg
+		if l := msg.result.DownloadLatency; l != nil && len(l.Samples) > 0 {
+			m.latencyPanel.BBDeltaDL = l.Avg - msg.result.IdleLatency.Avg
+		}
+		if l := msg.result.UploadLatency; l != nil && len(l.Samples) > 0 {
+			m.latencyPanel.BBDeltaUL = l.Avg - msg.result.IdleLatency.Avg
+		}
+		if l := msg.result.BidirLatency; l != nil {
+			m.latencyPanel.Bidir = true
+			m.latencyPanel.BBGradeBidir = msg.result.BufferbloatBidir
+			m.latencyPanel.BBDeltaBidir = l.Avg - msg.result.IdleLatency.Avg
+			m.latencyPanel.BidirDLMbps = msg.result.BidirDownload.Mbps
+			m.latencyPanel.BidirULMbps = msg.result.BidirUpload.Mbps
 		}
-		if len(msg.result.UploadLatency.Samples) > 0 {
-			m.latencyPanel.BBDeltaUL = msg.result.UploadLatency.Avg - msg.result.IdleLatency.Avg
+		if msg.result.Responsiveness != nil {
+			m.latencyPanel.RPM = msg.result.Responsiveness.RPM
+		}
+		if loss := msg.result.IdleLatency.Loss; loss != nil {
+			m.latencyPanel.HasLoss = true
+			m.latencyPanel.LossIdle = loss.LossPct
+			for _, l := range []*speedtest.LatencyResult{msg.result.DownloadLatency, msg.result.UploadLatency, msg.result.BidirLatency} {
+				if l != nil && l.Loss != nil && l.Loss.LossPct > m.latencyPanel.LossLoaded {
+					m.latencyPanel.LossLoaded = l.Loss.LossPct
+				}
+			}
 		}
 
 		m.footer.Done = true
@@ -199,8 +246,25 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case errMsg:
 		m.state = stateError
 		m.err = msg.err
+		if m.store != nil {
+			m.store.Save(speedtest.FailedResult(msg.err))
+		}
 		return m, nil
 	}
 
 	return m, nil
 }
+
+// exportResult writes result as JSON to a new file, refusing to overwrite
+// an earlier export.
+func exportResult(name string, result *speedtest.Result) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := export.ToJSON(f, result); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
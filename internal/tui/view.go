@@ -17,6 +17,9 @@ func (m Model) View() string {
 	if m.state == stateHelp {
 		return m.viewHelpScreen()
 	}
+	if m.state == stateDetail {
+		return m.viewDetailScreen()
+	}
 
 	var sections []string
 
@@ -54,13 +57,17 @@ func (m Model) View() string {
 		return lipgloss.JoinVertical(lipgloss.Left, sections...)
 	}
 
-	// Download gauge (always rendered, 2 lines)
-	sections = append(sections, m.dlGauge.View())
-	sections = append(sections, "")
+	// Download gauge (2 lines, unless the phase is skipped)
+	if !m.engine.Config.NoDownload {
+		sections = append(sections, m.dlGauge.View())
+		sections = append(sections, "")
+	}
 
-	// Upload gauge (always rendered, 2 lines)
-	sections = append(sections, m.ulGauge.View())
-	sections = append(sections, "")
+	// Upload gauge (2 lines, unless the phase is skipped)
+	if !m.engine.Config.NoUpload {
+		sections = append(sections, m.ulGauge.View())
+		sections = append(sections, "")
+	}
 
 	// Latency panel (always rendered, 3 lines)
 	sections = append(sections, m.latencyPanel.View())
@@ -103,14 +110,29 @@ func (m Model) statusLine() string {
 		return "  " + m.spinner.View() + " Testing download..."
 	case stateUpload:
 		return "  " + m.spinner.View() + " Testing upload..."
+	case stateBidir:
+		return "  " + m.spinner.View() + " Testing download and upload together..."
 	case stateDone:
 		if m.result != nil {
 			checkStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#00D4AA"))
-			dlStr := m.theme.Download.Render(fmt.Sprintf("%.0f↓", m.result.Download.Mbps))
-			ulStr := m.theme.Upload.Render(fmt.Sprintf("%.0f↑", m.result.Upload.Mbps))
+			var speeds []string
+			if dl := m.result.Download; dl != nil {
+				speeds = append(speeds, m.theme.Download.Render(fmt.Sprintf("%.0f↓", dl.Mbps)))
+			}
+			if ul := m.result.Upload; ul != nil {
+				speeds = append(speeds, m.theme.Upload.Render(fmt.Sprintf("%.0f↑", ul.Mbps)))
+			}
+			if len(speeds) == 0 {
+				latency := m.theme.Latency.Render(fmt.Sprintf("%.0fms", m.result.IdleLatency.Avg))
+				return "  " + checkStyle.Render("✓") + " " + latency + " idle latency"
+			}
 			unit := m.theme.SpeedUnit.Render(" Mbps")
-			grade := m.renderGrade(m.result.BufferbloatDL)
-			return "  " + checkStyle.Render("✓") + " " + dlStr + "  " + ulStr + unit + "  · Bufferbloat " + grade
+			line := "  " + checkStyle.Render("✓") + " " + strings.Join(speeds, "  ") + unit
+			grade := m.result.BufferbloatDL
+			if grade == "" {
+				grade = m.result.BufferbloatUL
+			}
+			return line + "  · Bufferbloat " + m.renderGrade(grade)
 		}
 		doneStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#00D4AA"))
 		return "  " + doneStyle.Render("✓") + " Test complete"
@@ -150,22 +172,33 @@ func (m Model) viewHistoryScreen() string {
 
 		for i, e := range m.historyEntries {
 			date := e.Timestamp.Format("2006-01-02 15:04")
+			if !e.Status.OK() {
+				errStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#FF4444"))
+				sections = append(sections, errStyle.Render(fmt.Sprintf("  %-18s  %-6s  %s",
+					date, "—", strings.ReplaceAll(string(e.Status), "_", " "))))
+				continue
+			}
 			server := e.Server.Colo
 			if server == "" {
 				server = "—"
 			}
 
-			dlArrow, ulArrow := " ", " "
-			if i < len(m.historyEntries)-1 {
-				prev := m.historyEntries[i+1]
-				dlArrow = trendArrow(e.Download.Mbps, prev.Download.Mbps)
-				ulArrow = trendArrow(e.Upload.Mbps, prev.Upload.Mbps)
+			prev, hasPrev := previousOK(m.historyEntries[i+1:])
+			speed := func(cur, prev *speedtest.PhaseResult) string {
+				if cur == nil {
+					return fmt.Sprintf("%13s", "—")
+				}
+				arrow := " "
+				if hasPrev && prev != nil {
+					arrow = trendArrow(cur.Mbps, prev.Mbps)
+				}
+				return fmt.Sprintf("%7.1f%s Mbps", cur.Mbps, arrow)
 			}
 
-			line := fmt.Sprintf("  %-18s  %-6s  %7.1f%s Mbps  %7.1f%s Mbps  %5.0fms  %5s",
+			line := fmt.Sprintf("  %-18s  %-6s  %s  %s  %5.0fms  %5s",
 				date, server,
-				e.Download.Mbps, dlArrow,
-				e.Upload.Mbps, ulArrow,
+				speed(e.Download, prev.Download),
+				speed(e.Upload, prev.Upload),
 				e.IdleLatency.Avg,
 				e.BufferbloatDL)
 			sections = append(sections, line)
@@ -179,6 +212,73 @@ func (m Model) viewHistoryScreen() string {
 	return lipgloss.JoinVertical(lipgloss.Left, sections...)
 }
 
+func (m Model) viewDetailScreen() string {
+	var sections []string
+
+	sections = append(sections, m.header.View())
+	sections = append(sections, "")
+
+	boldStyle := lipgloss.NewStyle().Bold(true)
+	mutedStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#888888"))
+
+	phases := []*speedtest.LatencyResult{
+		&m.result.IdleLatency,
+		m.result.DownloadLatency,
+		m.result.UploadLatency,
+	}
+	header := fmt.Sprintf("  %-14s  %10s  %10s  %10s", "Latency", "Idle", "Download", "Upload")
+	if m.result.BidirLatency != nil {
+		phases = append(phases, m.result.BidirLatency)
+		header += fmt.Sprintf("  %10s", "Both")
+	}
+
+	sections = append(sections, boldStyle.Render(header))
+	sections = append(sections, mutedStyle.Render("  "+strings.Repeat("─", len(phases)*12+14)))
+
+	stages := []struct {
+		name  string
+		stage func(*speedtest.LatencyBreakdown) speedtest.StageStats
+	}{
+		{"DNS lookup", func(b *speedtest.LatencyBreakdown) speedtest.StageStats { return b.DNS }},
+		{"TCP connect", func(b *speedtest.LatencyBreakdown) speedtest.StageStats { return b.Connect }},
+		{"TLS handshake", func(b *speedtest.LatencyBreakdown) speedtest.StageStats { return b.TLS }},
+		{"First byte", func(b *speedtest.LatencyBreakdown) speedtest.StageStats { return b.TTFB }},
+	}
+	for _, st := range stages {
+		line := fmt.Sprintf("  %-14s", st.name)
+		for _, p := range phases {
+			cell := "—"
+			if p != nil && p.Breakdown != nil {
+				if s := st.stage(p.Breakdown); s.Count > 0 {
+					cell = fmt.Sprintf("%.1fms", s.Avg)
+				}
+			}
+			line += fmt.Sprintf("  %10s", cell)
+		}
+		sections = append(sections, line)
+	}
+
+	total := fmt.Sprintf("  %-14s", "Round trip")
+	for _, p := range phases {
+		cell := "—"
+		if p != nil && len(p.Samples) > 0 {
+			cell = fmt.Sprintf("%.1fms", p.Avg)
+		}
+		total += fmt.Sprintf("  %10s", cell)
+	}
+	sections = append(sections, boldStyle.Render(total))
+
+	sections = append(sections, "")
+	sections = append(sections, mutedStyle.Render("  Averages over the probes in which each stage occurred. DNS, TCP and TLS"))
+	sections = append(sections, mutedStyle.Render("  come from probes on fresh connections; a slow lookup points at the"))
+	sections = append(sections, mutedStyle.Render("  resolver, slow first bytes at the path."))
+
+	sections = append(sections, "")
+	sections = append(sections, mutedStyle.Render("  Press ESC to go back"))
+
+	return lipgloss.JoinVertical(lipgloss.Left, sections...)
+}
+
 func (m Model) viewHelpScreen() string {
 	var sections []string
 
@@ -198,6 +298,8 @@ func (m Model) viewHelpScreen() string {
 		{"〜 Jitter", "Variation in latency; lower means more consistent."},
 		{"≋ Bufferbloat", "Latency increase when your connection is under load. The main cause of lag during video calls or gaming even on fast connections. Graded A+ (excellent) through F (severe)."},
 		{"⏱ Loaded Latency", "Latency measured while actively downloading or uploading."},
+		{"· RPM", "Round-trips Per Minute under load (IETF responsiveness), comparable to macOS networkQuality. Higher is better."},
+		{"· Packet Loss", "Share of UDP echo probes that never came back, idle and under load. Only measured with --echo."},
 	}
 
 	for _, e := range entries {
@@ -223,6 +325,17 @@ func (m Model) renderGrade(grade speedtest.BufferbloatGrade) string {
 	}
 }
 
+// previousOK returns the first completed run in entries, which are sorted
+// most recent first.
+func previousOK(entries []speedtest.Result) (speedtest.Result, bool) {
+	for _, e := range entries {
+		if e.Status.OK() {
+			return e, true
+		}
+	}
+	return speedtest.Result{}, false
+}
+
 func trendArrow(current, previous float64) string {
 	diff := current - previous
 	pct := diff / previous * 100